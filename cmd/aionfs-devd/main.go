@@ -3,52 +3,163 @@ package main
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/AtDexters-Lab/aionFS/internal/auth"
 	"github.com/AtDexters-Lab/aionFS/internal/httpapi"
+	"github.com/AtDexters-Lab/aionFS/internal/reload"
 	"github.com/AtDexters-Lab/aionFS/internal/store"
 )
 
+// tokenIssuerName is the iss and aud of tokens the server mints.
+const tokenIssuerName = "aionfs-devd"
+
 func main() {
 	listenAddr := flag.String("listen", "0.0.0.0:7080", "HTTP listen address")
 	dataDir := flag.String("data-dir", "./data", "Directory for persisted dev state")
 	tlsCert := flag.String("tls-cert", "", "Path to PEM encoded TLS certificate")
 	tlsKey := flag.String("tls-key", "", "Path to PEM encoded TLS private key")
 	tlsClientCA := flag.String("tls-client-ca", "", "Optional PEM bundle of client CAs for mTLS")
+	authModeName := flag.String("auth-mode", "token", "How callers authenticate: token, cert, either or both")
+	clientCertMap := flag.String("client-cert-map", "", "JSON map of client certificate SAN URIs or subjects to principals")
 	tokenFile := flag.String("token-file", "", "Optional JSON map of bearer tokens to principals")
+	jwtSecretFile := flag.String("jwt-hs256-secret-file", "", "Optional file holding an HS256 secret for verifying JWT bearer tokens")
+	jwtPublicKey := flag.String("jwt-public-key", "", "Optional PEM Ed25519 or P-256 public key for verifying JWT bearer tokens")
+	jwtJWKSFile := flag.String("jwt-jwks-file", "", "Optional local JWKS file of keys for verifying JWT bearer tokens")
+	jwtIssuer := flag.String("jwt-issuer", "", "Required iss claim of JWT bearer tokens")
+	jwtAudience := flag.String("jwt-audience", "", "Required aud claim of JWT bearer tokens")
+	jwtPrincipalClaim := flag.String("jwt-principal-claim", "sub", "JWT claim mapped to the principal")
+	jwtRolesClaim := flag.String("jwt-roles-claim", "roles", "JWT claim listing the principal's roles")
+	jwtScopesClaim := flag.String("jwt-scopes-claim", "scope", "JWT claim listing the token's scopes")
+	jwtLeeway := flag.Duration("jwt-leeway", 30*time.Second, "Clock skew tolerated when checking JWT exp and nbf")
+	tokenMinters := flag.String("token-minters", "", "Comma-separated client certificate common names allowed to mint tokens (requires -tls-client-ca)")
+	signingKey := flag.String("token-signing-key", "", "PEM Ed25519 key signing minted tokens (default <data-dir>/token-signing.pem, created if missing)")
+	adminPrincipals := flag.String("admin-principals", "", "Comma-separated principals allowed to use admin overrides")
+	leaseTTL := flag.Duration("lease-ttl", time.Minute, "Attach session lease duration")
+	poolCapacity := flag.Int64("pool-capacity-bytes", 0, "Total bytes persistent volumes may provision (0 for unlimited)")
+	ephemeralCapacity := flag.Int64("ephemeral-capacity-bytes", 0, "Total bytes ephemeral volumes may provision (0 for unlimited)")
+	ephemeralTTL := flag.Duration("ephemeral-ttl", 24*time.Hour, "Default lifetime of ephemeral volumes")
+	idempotencyTTL := flag.Duration("idempotency-ttl", 24*time.Hour, "How long responses to Idempotency-Key requests are replayable")
+	reloadInterval := flag.Duration("reload-interval", 10*time.Second, "How often to check the token file and TLS files for changes (0 to reload on SIGHUP only)")
+	capsuleMaxBytes := flag.Int64("capsule-max-bytes", 1<<20, "Maximum size of a checkpoint capsule payload")
 	flag.Parse()
 
+	authMode, err := httpapi.ParseAuthMode(*authModeName)
+	if err != nil {
+		log.Fatalf("invalid -auth-mode: %v", err)
+	}
+	if authMode != httpapi.AuthToken && (*clientCertMap == "" || *tlsClientCA == "") {
+		log.Fatalf("-auth-mode %s requires -client-cert-map and -tls-client-ca", authMode)
+	}
+
 	if err := os.MkdirAll(*dataDir, 0o755); err != nil {
 		log.Fatalf("failed to create data directory: %v", err)
 	}
 
-	var tokenProvider auth.TokenProvider
+	st, err := store.NewFileStore(*dataDir)
+	if err != nil {
+		log.Fatalf("failed to initialise state store: %v", err)
+	}
+	defer st.Close()
+	st.SetPoolCapacity(store.ClassPersistent, *poolCapacity)
+	st.SetPoolCapacity(store.ClassEphemeral, *ephemeralCapacity)
+
+	watcher := reload.NewWatcher()
+	var providers []auth.TokenProvider
 	if *tokenFile != "" {
 		provider, err := auth.NewStaticProvider(*tokenFile)
 		if err != nil {
 			log.Fatalf("failed to load token file: %v", err)
 		}
-		tokenProvider = provider
+		providers = append(providers, provider)
+		watcher.Add("token-file", []string{*tokenFile}, provider.Reload)
 		log.Printf("token provider loaded with %d entries", provider.Size())
 	}
-
-	st, err := store.NewFileStore(*dataDir)
-	if err != nil {
-		log.Fatalf("failed to initialise state store: %v", err)
+	jwtKeys := loadJWTKeys(*jwtSecretFile, *jwtPublicKey, *jwtJWKSFile)
+	if len(jwtKeys) > 0 {
+		provider, err := auth.NewJWTProvider(auth.JWTConfig{
+			Keys:           jwtKeys,
+			Issuer:         *jwtIssuer,
+			Audience:       *jwtAudience,
+			PrincipalClaim: *jwtPrincipalClaim,
+			RolesClaim:     *jwtRolesClaim,
+			ScopesClaim:    *jwtScopesClaim,
+			Leeway:         *jwtLeeway,
+		})
+		if err != nil {
+			log.Fatalf("failed to configure JWT provider: %v", err)
+		}
+		providers = append(providers, provider)
+		log.Printf("JWT provider loaded with %d keys", len(jwtKeys))
+	}
+	var issuer *auth.Issuer
+	if *tokenMinters != "" {
+		if *tlsClientCA == "" {
+			log.Fatal("-token-minters requires -tls-client-ca")
+		}
+		keyPath := *signingKey
+		if keyPath == "" {
+			keyPath = filepath.Join(*dataDir, "token-signing.pem")
+		}
+		key, err := auth.LoadOrCreateSigningKey(keyPath)
+		if err != nil {
+			log.Fatalf("failed to load token signing key: %v", err)
+		}
+		issuer = auth.NewIssuer(tokenIssuerName, key)
+		provider, err := issuer.Provider(st.TokenRevoked)
+		if err != nil {
+			log.Fatalf("failed to configure minted token provider: %v", err)
+		}
+		providers = append(providers, provider)
+		log.Printf("token minting enabled for %s", *tokenMinters)
+	}
+	var tokenProvider auth.TokenProvider
+	switch len(providers) {
+	case 0:
+	case 1:
+		tokenProvider = providers[0]
+	default:
+		tokenProvider = auth.Chain(providers...)
+	}
+	if authMode == httpapi.AuthBoth && tokenProvider == nil {
+		log.Fatal("-auth-mode both requires a token file, JWT keys or token minting")
 	}
-	defer st.Close()
 
-	tlsConfig := buildTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+	clientAuth := tls.RequireAndVerifyClientCert
+	if authMode == httpapi.AuthEither {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+	tlsConfig := buildTLSConfig(*tlsCert, *tlsKey, *tlsClientCA, clientAuth, watcher)
+
+	opts := []httpapi.Option{
+		httpapi.WithCapsuleLimit(*capsuleMaxBytes),
+		httpapi.WithAdmins(strings.Split(*adminPrincipals, ",")...),
+		httpapi.WithLeaseTTL(*leaseTTL),
+		httpapi.WithEphemeralTTL(*ephemeralTTL),
+		httpapi.WithIdempotencyTTL(*idempotencyTTL),
+		httpapi.WithReloadStatus(watcher.Statuses),
+	}
+	if issuer != nil {
+		opts = append(opts, httpapi.WithTokenIssuer(issuer, strings.Split(*tokenMinters, ",")...))
+	}
+	if authMode != httpapi.AuthToken {
+		mapper, err := auth.NewCertMapper(*clientCertMap)
+		if err != nil {
+			log.Fatalf("failed to load client cert map: %v", err)
+		}
+		opts = append(opts, httpapi.WithClientCerts(mapper, authMode))
+		log.Printf("client certificate auth (%s mode) loaded with %d entries", authMode, mapper.Size())
+	}
 
-	api := httpapi.NewServer(st, tokenProvider)
+	api := httpapi.NewServer(st, tokenProvider, opts...)
 	srv := &http.Server{
 		Addr:         *listenAddr,
 		Handler:      api.Router(),
@@ -73,19 +184,52 @@ func main() {
 		}
 	}()
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	stopReload := make(chan struct{})
+	go watcher.Run(*reloadInterval, hup, stopReload)
+
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 	<-sig
 
 	log.Printf("shutting down...")
+	close(stopReload)
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("error during shutdown: %v", err)
 	}
+	api.Close()
 }
 
-func buildTLSConfig(certPath, keyPath, clientCAPath string) *tls.Config {
+func loadJWTKeys(secretPath, publicKeyPath, jwksPath string) []auth.JWTKey {
+	var keys []auth.JWTKey
+	if secretPath != "" {
+		secret, err := os.ReadFile(secretPath)
+		if err != nil {
+			log.Fatalf("failed to read JWT secret: %v", err)
+		}
+		keys = append(keys, auth.JWTKey{Key: []byte(strings.TrimSpace(string(secret)))})
+	}
+	if publicKeyPath != "" {
+		key, err := auth.LoadPublicKeyPEM(publicKeyPath)
+		if err != nil {
+			log.Fatalf("failed to load JWT public key: %v", err)
+		}
+		keys = append(keys, auth.JWTKey{Key: key})
+	}
+	if jwksPath != "" {
+		jwks, err := auth.LoadJWKS(jwksPath)
+		if err != nil {
+			log.Fatalf("failed to load JWKS file: %v", err)
+		}
+		keys = append(keys, jwks...)
+	}
+	return keys
+}
+
+func buildTLSConfig(certPath, keyPath, clientCAPath string, clientAuth tls.ClientAuthType, watcher *reload.Watcher) *tls.Config {
 	if certPath == "" && keyPath == "" {
 		return nil
 	}
@@ -94,28 +238,10 @@ func buildTLSConfig(certPath, keyPath, clientCAPath string) *tls.Config {
 		log.Fatal("both --tls-cert and --tls-key must be provided for TLS")
 	}
 
-	certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+	source, err := reload.NewTLS(certPath, keyPath, clientCAPath, clientAuth)
 	if err != nil {
-		log.Fatalf("failed to load TLS keypair: %v", err)
-	}
-
-	tlsConfig := &tls.Config{
-		MinVersion:   tls.VersionTLS12,
-		Certificates: []tls.Certificate{certificate},
+		log.Fatalf("failed to load TLS configuration: %v", err)
 	}
-
-	if clientCAPath != "" {
-		caPEM, err := os.ReadFile(clientCAPath)
-		if err != nil {
-			log.Fatalf("failed to read client CA bundle: %v", err)
-		}
-		caPool := x509.NewCertPool()
-		if ok := caPool.AppendCertsFromPEM(caPEM); !ok {
-			log.Fatal("no client CAs found in provided bundle")
-		}
-		tlsConfig.ClientCAs = caPool
-		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
-	}
-
-	return tlsConfig
+	watcher.Add("tls", source.Paths(), source.Load)
+	return source.Config()
 }
@@ -2,7 +2,4 @@ module github.com/AtDexters-Lab/aionFS
 
 go 1.22.2
 
-require (
-	github.com/go-chi/chi/v5 v5.2.3
-	github.com/google/uuid v1.6.0
-)
+require github.com/go-chi/chi/v5 v5.2.3
@@ -0,0 +1,326 @@
+// Package archive encodes checkpoints as self-describing tar streams so they
+// can be moved between aionfs-devd instances.
+package archive
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+const (
+	// Format identifies checkpoint archives in the index entry.
+	Format = "aionfs-checkpoint-archive"
+	// Version is the archive layout revision written by this package.
+	Version = 1
+
+	indexName    = "aionfs-archive.json"
+	manifestName = "manifest.json"
+	capsuleName  = "capsule"
+	volumesDir   = "volumes/"
+	snapshotsDir = "snapshots/"
+
+	// paxChecksum carries the entry digest in each tar header as well.
+	paxChecksum = "AIONFS.sha256"
+)
+
+// Bundle is everything an archive carries for one checkpoint.
+type Bundle struct {
+	Checkpoint store.Checkpoint
+	Volumes    []Volume
+	Snapshots  []store.Snapshot
+	// Capsule holds the capsule payload when Checkpoint.Capsule is set.
+	Capsule []byte
+}
+
+// Volume is the part of a volume record an archive carries: what an import
+// needs to recreate the volume. Sessions, sharing, pending transfers and
+// history stay behind. The JSON names match store.Volume, so archives that
+// embedded full records still decode.
+type Volume struct {
+	VolumeID       string            `json:"volume_id"`
+	Name           string            `json:"name,omitempty"`
+	OwnerPrincipal string            `json:"owner_principal"`
+	Class          string            `json:"class"`
+	QuotaBytes     int64             `json:"quota_bytes"`
+	PolicyProfile  string            `json:"policy_profile"`
+	ExportMode     string            `json:"export_mode"`
+	AccessMode     string            `json:"access_mode"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+	RestoredFrom   string            `json:"restored_from,omitempty"`
+}
+
+// VolumeOf returns the archived form of v.
+func VolumeOf(v store.Volume) Volume {
+	return Volume{
+		VolumeID:       v.VolumeID,
+		Name:           v.Name,
+		OwnerPrincipal: v.OwnerPrincipal,
+		Class:          v.Class,
+		QuotaBytes:     v.QuotaBytes,
+		PolicyProfile:  v.PolicyProfile,
+		ExportMode:     v.ExportMode,
+		AccessMode:     v.AccessMode,
+		Labels:         v.Labels,
+		Annotations:    v.Annotations,
+		RestoredFrom:   v.RestoredFrom,
+	}
+}
+
+// Index is the first entry of every archive and lists the entries that follow.
+type Index struct {
+	Format           string    `json:"format"`
+	Version          int       `json:"version"`
+	CreatedAt        time.Time `json:"created_at"`
+	SourceManifestID string    `json:"source_manifest_id"`
+	Entries          []Entry   `json:"entries"`
+}
+
+// Entry describes one archive member and its checksum.
+type Entry struct {
+	Name      string `json:"name"`
+	SizeBytes int64  `json:"size_bytes"`
+	SHA256    string `json:"sha256"`
+}
+
+// ErrInvalid wraps every validation failure reported by Read.
+var ErrInvalid = errors.New("invalid checkpoint archive")
+
+type member struct {
+	name string
+	data []byte
+}
+
+// Write streams the bundle as a tar archive.
+func Write(w io.Writer, b Bundle) error {
+	members := make([]member, 0, 2+len(b.Volumes)+len(b.Snapshots))
+	add := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", name, err)
+		}
+		members = append(members, member{name: name, data: data})
+		return nil
+	}
+	if err := add(manifestName, b.Checkpoint); err != nil {
+		return err
+	}
+	for _, v := range b.Volumes {
+		if err := add(volumesDir+v.VolumeID+".json", v); err != nil {
+			return err
+		}
+	}
+	for _, snap := range b.Snapshots {
+		if err := add(snapshotsDir+snap.SnapshotID+".json", snap); err != nil {
+			return err
+		}
+	}
+	if b.Checkpoint.Capsule != nil {
+		members = append(members, member{name: capsuleName, data: b.Capsule})
+	}
+
+	idx := Index{
+		Format:           Format,
+		Version:          Version,
+		CreatedAt:        time.Now().UTC(),
+		SourceManifestID: b.Checkpoint.ManifestID,
+		Entries:          make([]Entry, 0, len(members)),
+	}
+	for _, m := range members {
+		idx.Entries = append(idx.Entries, Entry{Name: m.name, SizeBytes: int64(len(m.data)), SHA256: digest(m.data)})
+	}
+	idxData, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode index: %w", err)
+	}
+
+	tw := tar.NewWriter(w)
+	for _, m := range append([]member{{name: indexName, data: idxData}}, members...) {
+		hdr := &tar.Header{
+			Name:       m.name,
+			Mode:       0o600,
+			Size:       int64(len(m.data)),
+			ModTime:    idx.CreatedAt,
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{paxChecksum: digest(m.data)},
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("write %s header: %w", m.name, err)
+		}
+		if _, err := tw.Write(m.data); err != nil {
+			return fmt.Errorf("write %s: %w", m.name, err)
+		}
+	}
+	return tw.Close()
+}
+
+// Read parses and validates an archive. Every entry must be listed in the
+// index with a matching size and checksum, and the manifest, snapshot and
+// volume records must reference each other consistently. maxBytes bounds the
+// total payload read.
+func Read(r io.Reader, maxBytes int64) (Bundle, Index, error) {
+	tr := tar.NewReader(io.LimitReader(r, maxBytes+1))
+	var (
+		idx      Index
+		expected map[string]Entry
+		seen     = map[string]bool{}
+		b        Bundle
+		total    int64
+		manifest bool
+	)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Bundle{}, Index{}, invalid("read tar: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return Bundle{}, Index{}, invalid("unexpected non-file entry %s", hdr.Name)
+		}
+		total += hdr.Size
+		if total > maxBytes {
+			return Bundle{}, Index{}, invalid("archive exceeds %d bytes", maxBytes)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return Bundle{}, Index{}, invalid("read %s: %v", hdr.Name, err)
+		}
+		if sum, ok := hdr.PAXRecords[paxChecksum]; ok && sum != digest(data) {
+			return Bundle{}, Index{}, invalid("checksum mismatch for %s", hdr.Name)
+		}
+
+		if expected == nil {
+			if hdr.Name != indexName {
+				return Bundle{}, Index{}, invalid("first entry must be %s", indexName)
+			}
+			if err := json.Unmarshal(data, &idx); err != nil {
+				return Bundle{}, Index{}, invalid("decode index: %v", err)
+			}
+			if idx.Format != Format || idx.Version != Version {
+				return Bundle{}, Index{}, invalid("unsupported format %s version %d", idx.Format, idx.Version)
+			}
+			expected = make(map[string]Entry, len(idx.Entries))
+			for _, e := range idx.Entries {
+				expected[e.Name] = e
+			}
+			continue
+		}
+
+		entry, ok := expected[hdr.Name]
+		if !ok {
+			return Bundle{}, Index{}, invalid("entry %s is not listed in the index", hdr.Name)
+		}
+		if seen[hdr.Name] {
+			return Bundle{}, Index{}, invalid("duplicate entry %s", hdr.Name)
+		}
+		seen[hdr.Name] = true
+		if entry.SizeBytes != int64(len(data)) || entry.SHA256 != digest(data) {
+			return Bundle{}, Index{}, invalid("checksum mismatch for %s", hdr.Name)
+		}
+
+		switch {
+		case hdr.Name == manifestName:
+			if err := json.Unmarshal(data, &b.Checkpoint); err != nil {
+				return Bundle{}, Index{}, invalid("decode manifest: %v", err)
+			}
+			manifest = true
+		case hdr.Name == capsuleName:
+			b.Capsule = data
+		case strings.HasPrefix(hdr.Name, volumesDir) && path.Ext(hdr.Name) == ".json":
+			var v Volume
+			if err := json.Unmarshal(data, &v); err != nil {
+				return Bundle{}, Index{}, invalid("decode %s: %v", hdr.Name, err)
+			}
+			if hdr.Name != volumesDir+v.VolumeID+".json" {
+				return Bundle{}, Index{}, invalid("entry %s holds volume %s", hdr.Name, v.VolumeID)
+			}
+			b.Volumes = append(b.Volumes, v)
+		case strings.HasPrefix(hdr.Name, snapshotsDir) && path.Ext(hdr.Name) == ".json":
+			var snap store.Snapshot
+			if err := json.Unmarshal(data, &snap); err != nil {
+				return Bundle{}, Index{}, invalid("decode %s: %v", hdr.Name, err)
+			}
+			if hdr.Name != snapshotsDir+snap.SnapshotID+".json" {
+				return Bundle{}, Index{}, invalid("entry %s holds snapshot %s", hdr.Name, snap.SnapshotID)
+			}
+			b.Snapshots = append(b.Snapshots, snap)
+		default:
+			return Bundle{}, Index{}, invalid("unknown entry %s", hdr.Name)
+		}
+	}
+
+	if expected == nil {
+		return Bundle{}, Index{}, invalid("archive is empty")
+	}
+	for name := range expected {
+		if !seen[name] {
+			return Bundle{}, Index{}, invalid("entry %s listed in the index is missing", name)
+		}
+	}
+	if !manifest {
+		return Bundle{}, Index{}, invalid("manifest is missing")
+	}
+	if err := validate(b); err != nil {
+		return Bundle{}, Index{}, err
+	}
+	return b, idx, nil
+}
+
+// validate checks that the records in a bundle reference each other.
+func validate(b Bundle) error {
+	volumes := make(map[string]bool, len(b.Volumes))
+	for _, v := range b.Volumes {
+		if volumes[v.VolumeID] {
+			return invalid("volume %s appears more than once", v.VolumeID)
+		}
+		volumes[v.VolumeID] = true
+	}
+	snaps := make(map[string]store.Snapshot, len(b.Snapshots))
+	for _, snap := range b.Snapshots {
+		if !volumes[snap.VolumeID] {
+			return invalid("snapshot %s references volume %s that is not in the archive", snap.SnapshotID, snap.VolumeID)
+		}
+		if _, ok := snaps[snap.SnapshotID]; ok {
+			return invalid("snapshot %s appears more than once", snap.SnapshotID)
+		}
+		snaps[snap.SnapshotID] = snap
+	}
+	for _, sid := range b.Checkpoint.SnapshotIDs {
+		if _, ok := snaps[sid]; !ok {
+			return invalid("manifest references snapshot %s that is not in the archive", sid)
+		}
+	}
+	if len(snaps) != len(b.Checkpoint.SnapshotIDs) {
+		return invalid("archive carries snapshots the manifest does not reference")
+	}
+	switch {
+	case b.Checkpoint.Capsule == nil && b.Capsule != nil:
+		return invalid("archive carries a capsule the manifest does not declare")
+	case b.Checkpoint.Capsule != nil && b.Capsule == nil:
+		return invalid("manifest declares a capsule that is missing")
+	case b.Checkpoint.Capsule != nil && b.Checkpoint.Capsule.SHA256 != digest(b.Capsule):
+		return invalid("capsule does not match the manifest digest")
+	}
+	return nil
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,173 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+func sampleBundle() Bundle {
+	capsule := []byte(`{"step":1}`)
+	return Bundle{
+		Checkpoint: store.Checkpoint{
+			ManifestID:  "chk-1",
+			SnapshotIDs: []string{"snap-1", "snap-2"},
+			Capsule:     &store.CapsuleInfo{ContentType: "application/json", SizeBytes: int64(len(capsule)), SHA256: digest(capsule)},
+		},
+		Volumes: []Volume{
+			{VolumeID: "vol-1", Name: "data", OwnerPrincipal: "svc", Class: store.ClassPersistent, QuotaBytes: 1 << 20, ExportMode: store.ExportFS},
+			{VolumeID: "vol-2", OwnerPrincipal: "svc", Labels: map[string]string{"app": "web"}},
+		},
+		Snapshots: []store.Snapshot{
+			{SnapshotID: "snap-1", VolumeID: "vol-1"},
+			{SnapshotID: "snap-2", VolumeID: "vol-2"},
+		},
+		Capsule: capsule,
+	}
+}
+
+func encode(t *testing.T, b Bundle) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, b); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func jsonOf(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// tarOf writes members as a tar stream behind an index that lists them with
+// correct checksums, so only the content of the members is under test.
+func tarOf(t *testing.T, members ...member) []byte {
+	t.Helper()
+	idx := Index{Format: Format, Version: Version}
+	for _, m := range members {
+		idx.Entries = append(idx.Entries, Entry{Name: m.name, SizeBytes: int64(len(m.data)), SHA256: digest(m.data)})
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range append([]member{{name: indexName, data: jsonOf(t, idx)}}, members...) {
+		if err := tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0o600, Size: int64(len(m.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(m.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	withoutCapsule := sampleBundle()
+	withoutCapsule.Checkpoint.Capsule = nil
+	withoutCapsule.Capsule = nil
+
+	for name, want := range map[string]Bundle{"with capsule": sampleBundle(), "without capsule": withoutCapsule} {
+		t.Run(name, func(t *testing.T) {
+			got, idx, err := Read(bytes.NewReader(encode(t, want)), 1<<20)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if idx.SourceManifestID != want.Checkpoint.ManifestID {
+				t.Fatalf("source manifest = %q, want %q", idx.SourceManifestID, want.Checkpoint.ManifestID)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("bundle = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestReadAcceptsFullVolumeRecords checks that archives written when volumes
+// were exported whole still import.
+func TestReadAcceptsFullVolumeRecords(t *testing.T) {
+	full := store.Volume{
+		VolumeID:       "vol-1",
+		OwnerPrincipal: "svc",
+		QuotaBytes:     1 << 20,
+		AttachSessions: []store.Session{{SessionID: "sess-1", Principal: "svc"}},
+		ACL:            []store.ACLEntry{{Principal: "other"}},
+	}
+	data := tarOf(t,
+		member{name: manifestName, data: jsonOf(t, store.Checkpoint{ManifestID: "chk-1", SnapshotIDs: []string{"snap-1"}})},
+		member{name: volumesDir + "vol-1.json", data: jsonOf(t, full)},
+		member{name: snapshotsDir + "snap-1.json", data: jsonOf(t, store.Snapshot{SnapshotID: "snap-1", VolumeID: "vol-1"})},
+	)
+	b, _, err := Read(bytes.NewReader(data), 1<<20)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	want := Volume{VolumeID: "vol-1", OwnerPrincipal: "svc", QuotaBytes: 1 << 20}
+	if len(b.Volumes) != 1 || !reflect.DeepEqual(b.Volumes[0], want) {
+		t.Fatalf("volumes = %+v, want [%+v]", b.Volumes, want)
+	}
+}
+
+func TestReadRejectsCorruptArchives(t *testing.T) {
+	valid := encode(t, sampleBundle())
+	manifest := member{name: manifestName, data: jsonOf(t, store.Checkpoint{ManifestID: "chk-1", SnapshotIDs: []string{"snap-1"}})}
+	snapshot := member{name: snapshotsDir + "snap-1.json", data: jsonOf(t, store.Snapshot{SnapshotID: "snap-1", VolumeID: "vol-1"})}
+	volume := member{name: volumesDir + "vol-1.json", data: jsonOf(t, Volume{VolumeID: "vol-1"})}
+
+	// The manifest follows the index, so the last mention of its ID is in the
+	// manifest entry itself.
+	flipped := bytes.Clone(valid)
+	flipped[bytes.LastIndex(flipped, []byte(`"chk-1"`))+1] ^= 0x01
+
+	duplicateVolumes := sampleBundle()
+	duplicateVolumes.Volumes = append(duplicateVolumes.Volumes, duplicateVolumes.Volumes[0])
+
+	badCapsule := sampleBundle()
+	badCapsule.Capsule = []byte(`{"step":2}`)
+
+	cases := []struct {
+		name     string
+		data     []byte
+		maxBytes int64
+	}{
+		{"empty", nil, 1 << 20},
+		{"not a tar", []byte("not an archive"), 1 << 20},
+		{"truncated", valid[:len(valid)/2], 1 << 20},
+		{"tampered entry", flipped, 1 << 20},
+		{"over limit", valid, 64},
+		{"missing index", func() []byte {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			_ = tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0o600, Size: int64(len(manifest.data))})
+			_, _ = tw.Write(manifest.data)
+			_ = tw.Close()
+			return buf.Bytes()
+		}(), 1 << 20},
+		{"missing manifest", tarOf(t, volume, snapshot), 1 << 20},
+		{"unknown entry", tarOf(t, manifest, volume, snapshot, member{name: "extra.bin", data: []byte("x")}), 1 << 20},
+		{"volume under another name", tarOf(t, manifest, member{name: volumesDir + "vol-2.json", data: volume.data}, snapshot), 1 << 20},
+		{"snapshot without volume", tarOf(t, manifest, snapshot), 1 << 20},
+		{"unreferenced snapshot", tarOf(t, manifest, volume, snapshot, member{name: snapshotsDir + "snap-2.json", data: jsonOf(t, store.Snapshot{SnapshotID: "snap-2", VolumeID: "vol-1"})}), 1 << 20},
+		{"duplicate volume", encode(t, duplicateVolumes), 1 << 20},
+		{"capsule digest mismatch", encode(t, badCapsule), 1 << 20},
+		{"undeclared capsule", tarOf(t, manifest, volume, snapshot, member{name: capsuleName, data: []byte("{}")}), 1 << 20},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := Read(bytes.NewReader(tc.data), tc.maxBytes); !errors.Is(err, ErrInvalid) {
+				t.Fatalf("Read = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
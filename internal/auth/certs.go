@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownCertificate is returned for client certificates that no mapping
+// entry matches.
+var ErrUnknownCertificate = errors.New("client certificate is not mapped to a principal")
+
+// CertMapper maps verified client certificates to identities. It loads a
+// JSON map keyed by SAN URI or by subject distinguished name, with values in
+// the same form as the token file:
+//
+//	{
+//	  "spiffe://piccolo/service/app1": "service:app1",
+//	  "spiffe://piccolo/tenant/*": "tenant:*",
+//	  "CN=orchestrator,O=Piccolo": {"principal": "service:orch", "role": "operator"}
+//	}
+//
+// A key ending in * matches by prefix, and a * in the principal is replaced
+// by the rest of the matched name. Exact keys win, then the longest prefix.
+type CertMapper struct {
+	exact    map[string]Identity
+	prefixes []certPrefix
+}
+
+type certPrefix struct {
+	prefix string
+	id     Identity
+}
+
+// NewCertMapper constructs a mapper from a path.
+func NewCertMapper(path string) (*CertMapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cert map: %w", err)
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse cert map: %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("cert map contained no entries")
+	}
+	m := &CertMapper{exact: map[string]Identity{}}
+	for name, value := range raw {
+		var entry tokenEntry
+		if err := json.Unmarshal(value, &entry.Principal); err != nil {
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return nil, fmt.Errorf("parse cert map: entry must be a principal or an object: %w", err)
+			}
+		}
+		if entry.Principal == "" {
+			return nil, fmt.Errorf("parse cert map: %s has no principal", name)
+		}
+		role, err := ParseRole(entry.Role)
+		if err != nil {
+			return nil, fmt.Errorf("parse cert map: %s: %w", name, err)
+		}
+		id := Identity{Principal: entry.Principal, Role: role}
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			m.prefixes = append(m.prefixes, certPrefix{prefix: prefix, id: id})
+			continue
+		}
+		m.exact[name] = id
+	}
+	sort.Slice(m.prefixes, func(i, j int) bool {
+		return len(m.prefixes[i].prefix) > len(m.prefixes[j].prefix)
+	})
+	return m, nil
+}
+
+// Identify returns the identity for a verified certificate. SAN URIs are
+// tried before the subject.
+func (m *CertMapper) Identify(cert *x509.Certificate) (Identity, error) {
+	names := make([]string, 0, len(cert.URIs)+1)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	names = append(names, cert.Subject.String())
+	for _, name := range names {
+		if id, ok := m.exact[name]; ok {
+			return id, nil
+		}
+	}
+	for _, name := range names {
+		for _, p := range m.prefixes {
+			rest, ok := strings.CutPrefix(name, p.prefix)
+			if !ok || rest == "" {
+				continue
+			}
+			id := p.id
+			id.Principal = strings.ReplaceAll(id.Principal, "*", rest)
+			return id, nil
+		}
+	}
+	return Identity{}, ErrUnknownCertificate
+}
+
+// Size returns the number of mapping entries.
+func (m *CertMapper) Size() int {
+	return len(m.exact) + len(m.prefixes)
+}
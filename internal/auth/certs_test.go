@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCertMapperIdentify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "certs.json")
+	err := os.WriteFile(path, []byte(`{
+		"spiffe://piccolo/service/app1": "service:app1",
+		"spiffe://piccolo/service/*": "service:*",
+		"spiffe://piccolo/*": {"principal": "other", "role": "auditor"},
+		"spiffe://piccolo/tenant/*": "tenant:*",
+		"CN=orchestrator,O=Piccolo": {"principal": "service:orch", "role": "operator"}
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewCertMapper(path)
+	if err != nil {
+		t.Fatalf("NewCertMapper: %v", err)
+	}
+	if m.Size() != 5 {
+		t.Fatalf("Size = %d, want 5", m.Size())
+	}
+
+	cases := []struct {
+		name    string
+		uri     string
+		subject pkix.Name
+		want    Identity
+	}{
+		{"exact uri", "spiffe://piccolo/service/app1", pkix.Name{}, Identity{Principal: "service:app1", Role: RoleTenant}},
+		{"longest prefix", "spiffe://piccolo/service/app2", pkix.Name{}, Identity{Principal: "service:app2", Role: RoleTenant}},
+		{"substitution", "spiffe://piccolo/tenant/acme", pkix.Name{}, Identity{Principal: "tenant:acme", Role: RoleTenant}},
+		{"shorter prefix", "spiffe://piccolo/batch/job", pkix.Name{}, Identity{Principal: "other", Role: RoleAuditor}},
+		{"subject", "", pkix.Name{CommonName: "orchestrator", Organization: []string{"Piccolo"}}, Identity{Principal: "service:orch", Role: RoleOperator}},
+		{"exact subject beats uri prefix", "spiffe://piccolo/service/x", pkix.Name{CommonName: "orchestrator", Organization: []string{"Piccolo"}}, Identity{Principal: "service:orch", Role: RoleOperator}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cert := &x509.Certificate{Subject: tc.subject}
+			if tc.uri != "" {
+				u, err := url.Parse(tc.uri)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cert.URIs = []*url.URL{u}
+			}
+			got, err := m.Identify(cert)
+			if err != nil {
+				t.Fatalf("Identify: %v", err)
+			}
+			if got.Principal != tc.want.Principal || got.Role != tc.want.Role {
+				t.Fatalf("Identify = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	for _, uri := range []string{"spiffe://elsewhere/app", "spiffe://piccolo/"} {
+		u, _ := url.Parse(uri)
+		cert := &x509.Certificate{URIs: []*url.URL{u}, Subject: pkix.Name{CommonName: "stranger"}}
+		if _, err := m.Identify(cert); !errors.Is(err, ErrUnknownCertificate) {
+			t.Fatalf("Identify(%s) = %v, want ErrUnknownCertificate", uri, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import "errors"
+
+var (
+	// ErrUnknownToken is returned by providers that do not recognise a
+	// token at all.
+	ErrUnknownToken = errors.New("unknown token")
+	// ErrInvalidToken is matched by failures to verify a token a provider
+	// does recognise, such as a bad signature or an expired JWT.
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Identity is the caller a bearer token authenticates.
+type Identity struct {
+	Principal string `json:"principal"`
+	Role      Role   `json:"role"`
+	// Scopes are carried through from tokens that grant them, such as JWTs.
+	Scopes []string `json:"scopes,omitempty"`
+	// Volumes, when set, limits the token to the listed volume IDs.
+	Volumes []string `json:"volume_ids,omitempty"`
+	// TokenID is the jti of a JWT, used to revoke it.
+	TokenID string `json:"token_id,omitempty"`
+}
+
+// TokenProvider resolves the identity behind a bearer token.
+type TokenProvider interface {
+	Authenticate(token string) (Identity, error)
+}
+
+// Chain tries each provider in turn and returns the first identity found.
+// When every provider fails, the most specific error is returned.
+func Chain(providers ...TokenProvider) TokenProvider {
+	return chain(providers)
+}
+
+type chain []TokenProvider
+
+func (c chain) Authenticate(token string) (Identity, error) {
+	err := ErrUnknownToken
+	for _, p := range c {
+		id, perr := p.Authenticate(token)
+		if perr == nil {
+			return id, nil
+		}
+		if !errors.Is(perr, ErrUnknownToken) {
+			err = perr
+		}
+	}
+	return Identity{}, err
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/ids"
+)
+
+// Issuer mints short-lived EdDSA JWTs signed with a server-held key. Its
+// tokens carry no role, so their principals are tenants.
+type Issuer struct {
+	name  string
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewIssuer returns an issuer that signs as name, which becomes both the iss
+// and aud of its tokens.
+func NewIssuer(name string, key ed25519.PrivateKey) *Issuer {
+	sum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	return &Issuer{name: name, keyID: hex.EncodeToString(sum[:8]), key: key}
+}
+
+// MintRequest describes a token to mint.
+type MintRequest struct {
+	Principal string
+	Scopes    []string
+	Volumes   []string
+	TTL       time.Duration
+}
+
+// MintedToken is a signed token and the ID that revokes it.
+type MintedToken struct {
+	Token     string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// Mint signs a token for req, issued at now.
+func (i *Issuer) Mint(req MintRequest, now time.Time) (MintedToken, error) {
+	if strings.TrimSpace(req.Principal) == "" {
+		return MintedToken{}, errors.New("mint: principal is required")
+	}
+	if req.TTL <= 0 {
+		return MintedToken{}, errors.New("mint: ttl must be positive")
+	}
+	expires := now.Add(req.TTL).Truncate(time.Second)
+	claims := map[string]interface{}{
+		"iss": i.name,
+		"aud": i.name,
+		"sub": req.Principal,
+		"jti": ids.New(ids.Token),
+		"iat": now.Unix(),
+		"exp": expires.Unix(),
+	}
+	if len(req.Scopes) > 0 {
+		claims["scope"] = strings.Join(req.Scopes, " ")
+	}
+	if len(req.Volumes) > 0 {
+		claims[claimVolumes] = req.Volumes
+	}
+	header, err := json.Marshal(jwtHeader{Alg: AlgEdDSA, Kid: i.keyID})
+	if err != nil {
+		return MintedToken{}, err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return MintedToken{}, err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig := ed25519.Sign(i.key, []byte(signed))
+	return MintedToken{
+		Token:     signed + "." + base64.RawURLEncoding.EncodeToString(sig),
+		TokenID:   claims["jti"].(string),
+		ExpiresAt: expires.UTC(),
+	}, nil
+}
+
+// Provider returns a TokenProvider accepting the issuer's tokens unless
+// revoked reports them.
+func (i *Issuer) Provider(revoked func(tokenID string) bool) (*JWTProvider, error) {
+	return NewJWTProvider(JWTConfig{
+		Keys:     []JWTKey{{ID: i.keyID, Key: i.key.Public().(ed25519.PublicKey)}},
+		Issuer:   i.name,
+		Audience: i.name,
+		Revoked:  revoked,
+	})
+}
+
+// LoadOrCreateSigningKey reads a PKCS#8 PEM Ed25519 private key, generating
+// and saving one with owner-only permissions when path does not exist.
+func LoadOrCreateSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generate signing key: %w", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("encode signing key: %w", err)
+		}
+		pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(path, pemBytes, 0o600); err != nil {
+			return nil, fmt.Errorf("write signing key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("read signing key: no PEM block found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse signing key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("parse signing key: want Ed25519, got %T", parsed)
+	}
+	return key, nil
+}
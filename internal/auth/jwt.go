@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWT signing algorithms the provider verifies.
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgES256 = "ES256"
+)
+
+// claimVolumes is the array claim restricting a token to some volumes.
+const claimVolumes = "volume_ids"
+
+// JWTKey is a verification key. Key is a []byte secret for HS256, an
+// ed25519.PublicKey for EdDSA or a P-256 *ecdsa.PublicKey for ES256. ID
+// matches the kid header when set.
+type JWTKey struct {
+	ID  string
+	Key interface{}
+}
+
+// JWTConfig configures a JWTProvider.
+type JWTConfig struct {
+	Keys []JWTKey
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// PrincipalClaim names the claim holding the principal. Defaults to
+	// "sub".
+	PrincipalClaim string
+	// RolesClaim names a string or array claim of role names. The most
+	// privileged recognised role wins and others are ignored. Defaults to
+	// "roles".
+	RolesClaim string
+	// ScopesClaim names a space-separated string or array claim of scopes.
+	// Defaults to "scope".
+	ScopesClaim string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+	// Revoked, when set, refuses tokens whose jti it reports. Tokens without
+	// a jti are then refused too.
+	Revoked func(tokenID string) bool
+	// Now replaces the clock, for tests.
+	Now func() time.Time
+}
+
+// JWTProvider authenticates signed JWTs. Every token must carry exp.
+type JWTProvider struct {
+	cfg JWTConfig
+}
+
+// NewJWTProvider validates the configuration and fills in defaults.
+func NewJWTProvider(cfg JWTConfig) (*JWTProvider, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, errors.New("jwt: no verification keys configured")
+	}
+	for _, k := range cfg.Keys {
+		if keyAlg(k.Key) == "" {
+			return nil, fmt.Errorf("jwt: key %q has unsupported type %T", k.ID, k.Key)
+		}
+		if secret, ok := k.Key.([]byte); ok && len(secret) < 32 {
+			return nil, fmt.Errorf("jwt: HS256 secret %q is shorter than 32 bytes", k.ID)
+		}
+	}
+	if cfg.PrincipalClaim == "" {
+		cfg.PrincipalClaim = "sub"
+	}
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = "roles"
+	}
+	if cfg.ScopesClaim == "" {
+		cfg.ScopesClaim = "scope"
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &JWTProvider{cfg: cfg}, nil
+}
+
+// keyAlg returns the algorithm a key verifies, or "" for unsupported keys.
+func keyAlg(key interface{}) string {
+	switch k := key.(type) {
+	case []byte:
+		return AlgHS256
+	case ed25519.PublicKey:
+		if len(k) == ed25519.PublicKeySize {
+			return AlgEdDSA
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return AlgES256
+		}
+	}
+	return ""
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+}
+
+func invalidToken(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidToken, fmt.Sprintf(format, args...))
+}
+
+// Authenticate implements TokenProvider. Tokens that are not shaped like a
+// JWT return ErrUnknownToken so other providers may try them.
+func (p *JWTProvider) Authenticate(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, ErrUnknownToken
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Identity{}, ErrUnknownToken
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg == "" {
+		return Identity{}, ErrUnknownToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, invalidToken("malformed signature")
+	}
+	if !p.verify(header, []byte(parts[0]+"."+parts[1]), sig) {
+		return Identity{}, invalidToken("signature not verified")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Identity{}, invalidToken("malformed payload")
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Identity{}, invalidToken("malformed claims")
+	}
+	if err := p.checkClaims(claims); err != nil {
+		return Identity{}, err
+	}
+
+	principal, _ := claims[p.cfg.PrincipalClaim].(string)
+	if strings.TrimSpace(principal) == "" {
+		return Identity{}, invalidToken("missing %s claim", p.cfg.PrincipalClaim)
+	}
+	id := Identity{Principal: principal, Role: RoleTenant}
+	for _, name := range stringsClaim(claims[p.cfg.RolesClaim]) {
+		if role, err := ParseRole(name); err == nil && role.rank() > id.Role.rank() {
+			id.Role = role
+		}
+	}
+	id.Scopes = stringsClaim(claims[p.cfg.ScopesClaim])
+	id.Volumes = stringsClaim(claims[claimVolumes])
+	id.TokenID, _ = claims["jti"].(string)
+	if p.cfg.Revoked != nil && (id.TokenID == "" || p.cfg.Revoked(id.TokenID)) {
+		return Identity{}, invalidToken("token revoked")
+	}
+	return id, nil
+}
+
+// verify checks the signature against every configured key for the header's
+// algorithm, or only the key named by kid.
+func (p *JWTProvider) verify(header jwtHeader, signed, sig []byte) bool {
+	for _, k := range p.cfg.Keys {
+		if keyAlg(k.Key) != header.Alg || (header.Kid != "" && k.ID != header.Kid) {
+			continue
+		}
+		switch key := k.Key.(type) {
+		case []byte:
+			mac := hmac.New(sha256.New, key)
+			mac.Write(signed)
+			if hmac.Equal(sig, mac.Sum(nil)) {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, signed, sig) {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			if len(sig) != 64 {
+				continue
+			}
+			digest := sha256.Sum256(signed)
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			if ecdsa.Verify(key, digest[:], r, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *JWTProvider) checkClaims(claims map[string]interface{}) error {
+	now := p.cfg.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return invalidToken("missing exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(p.cfg.Leeway)) {
+		return invalidToken("token expired")
+	}
+	if raw, present := claims["nbf"]; present {
+		nbf, ok := raw.(float64)
+		if !ok {
+			return invalidToken("malformed nbf claim")
+		}
+		if now.Add(p.cfg.Leeway).Before(time.Unix(int64(nbf), 0)) {
+			return invalidToken("token not yet valid")
+		}
+	}
+	if p.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != p.cfg.Issuer {
+			return invalidToken("unexpected issuer")
+		}
+	}
+	if p.cfg.Audience != "" {
+		found := false
+		for _, aud := range stringsClaim(claims["aud"]) {
+			if aud == p.cfg.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return invalidToken("token not issued for this audience")
+		}
+	}
+	return nil
+}
+
+// stringsClaim reads a claim that is either a space-separated string or an
+// array of strings.
+func stringsClaim(v interface{}) []string {
+	switch c := v.(type) {
+	case string:
+		return strings.Fields(c)
+	case []interface{}:
+		out := make([]string, 0, len(c))
+		for _, item := range c {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// LoadJWKS reads verification keys from a local JWKS file. It accepts oct
+// secrets, Ed25519 OKP keys and P-256 EC keys; keys of other types, or not
+// meant for signatures, are skipped.
+func LoadJWKS(path string) ([]JWTKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwks: %w", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+	keys := make([]JWTKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("parse jwks: key %q: %w", k.Kid, err)
+		}
+		if key != nil {
+			keys = append(keys, JWTKey{ID: k.Kid, Key: key})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("parse jwks: no supported signing keys")
+	}
+	return keys, nil
+}
+
+// parse returns the key's verification key, or nil for unsupported types.
+func (k jwk) parse() (interface{}, error) {
+	field := func(name, value string) ([]byte, error) {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid %s", name)
+		}
+		return b, nil
+	}
+	switch {
+	case k.Kty == "oct":
+		return field("k", k.K)
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := field("x", k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key length")
+		}
+		return ed25519.PublicKey(x), nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := field("x", k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := field("y", k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid P-256 coordinates")
+		}
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("point not on P-256")
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+	return nil, nil
+}
+
+// LoadPublicKeyPEM reads an Ed25519 or P-256 public key from a PEM encoded
+// PKIX file.
+func LoadPublicKeyPEM(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("read public key: no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	if keyAlg(key) == "" || keyAlg(key) == AlgHS256 {
+		return nil, fmt.Errorf("parse public key: unsupported key type %T", key)
+	}
+	return key, nil
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := b64.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// jwtNow is the clock for tokens built by signJWT.
+var jwtNow = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestJWTProvider(t *testing.T, cfg JWTConfig) *JWTProvider {
+	t.Helper()
+	if cfg.Now == nil {
+		cfg.Now = func() time.Time { return jwtNow }
+	}
+	p, err := NewJWTProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewJWTProvider: %v", err)
+	}
+	return p
+}
+
+// signJWT encodes header and claims and signs them with key, which is a
+// []byte secret, an ed25519.PrivateKey or an *ecdsa.PrivateKey.
+func signJWT(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+	enc := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b64.EncodeToString(b)
+	}
+	signed := enc(header) + "." + enc(claims)
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		t.Fatalf("unsupported key %T", key)
+	}
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func claimsFor(principal string, ttl time.Duration) map[string]interface{} {
+	return map[string]interface{}{"sub": principal, "exp": jwtNow.Add(ttl).Unix()}
+}
+
+func expectInvalid(t *testing.T, p *JWTProvider, token, reason string) {
+	t.Helper()
+	_, err := p.Authenticate(token)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Authenticate = %v, want ErrInvalidToken", err)
+	}
+	if !strings.Contains(err.Error(), reason) {
+		t.Fatalf("Authenticate = %v, want %q", err, reason)
+	}
+}
+
+// The vectors below are the examples of RFC 7515 appendices A.1 and A.3 and
+// RFC 8037 appendix A.4.
+const (
+	rfcHS256Key   = "AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow"
+	rfcHS256Token = "eyJ0eXAiOiJKV1QiLA0KICJhbGciOiJIUzI1NiJ9" +
+		".eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ" +
+		".dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	rfcES256X     = "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU"
+	rfcES256Y     = "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"
+	rfcES256Token = "eyJhbGciOiJFUzI1NiJ9" +
+		".eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ" +
+		".DtEhU3ljbEg8L38VWAfUAqOyKAM6-Xx-F4GawxaepmXFCgfTjDxw5djxLa8ISlSApmWQxfKTUJqPP3-Kg6NU1Q"
+
+	rfcEdDSAX   = "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+	rfcEdDSAJWS = "eyJhbGciOiJFZERTQSJ9" +
+		".RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc" +
+		".hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg"
+)
+
+func TestJWTKnownAnswers(t *testing.T) {
+	// The RFC 7515 claims name joe as issuer and expire in March 2011.
+	before := func() time.Time { return time.Unix(1300819000, 0) }
+	es256 := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(mustDecode(t, rfcES256X)),
+		Y:     new(big.Int).SetBytes(mustDecode(t, rfcES256Y)),
+	}
+	cases := []struct {
+		name  string
+		key   interface{}
+		token string
+	}{
+		{"HS256", mustDecode(t, rfcHS256Key), rfcHS256Token},
+		{"ES256", es256, rfcES256Token},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestJWTProvider(t, JWTConfig{Keys: []JWTKey{{Key: tc.key}}, PrincipalClaim: "iss", Now: before})
+			id, err := p.Authenticate(tc.token)
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if id.Principal != "joe" || id.Role != RoleTenant {
+				t.Fatalf("identity = %+v", id)
+			}
+			tampered := tc.token[:len(tc.token)-2] + "AA"
+			expectInvalid(t, p, tampered, "signature not verified")
+		})
+	}
+
+	// The RFC 8037 payload is not a claim set, so only the signature is
+	// checked.
+	t.Run("EdDSA", func(t *testing.T) {
+		p := newTestJWTProvider(t, JWTConfig{Keys: []JWTKey{{Key: ed25519.PublicKey(mustDecode(t, rfcEdDSAX))}}})
+		parts := strings.Split(rfcEdDSAJWS, ".")
+		header := jwtHeader{Alg: AlgEdDSA}
+		sig := mustDecode(t, parts[2])
+		if !p.verify(header, []byte(parts[0]+"."+parts[1]), sig) {
+			t.Fatal("RFC 8037 signature not verified")
+		}
+		sig[0] ^= 1
+		if p.verify(header, []byte(parts[0]+"."+parts[1]), sig) {
+			t.Fatal("tampered signature verified")
+		}
+	})
+}
+
+func TestJWTClaimsMapToIdentity(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	p := newTestJWTProvider(t, JWTConfig{Keys: []JWTKey{{Key: secret}}, Issuer: "aionfs", Audience: "aionfs"})
+	claims := claimsFor("svc", time.Hour)
+	claims["iss"] = "aionfs"
+	claims["aud"] = []string{"other", "aionfs"}
+	claims["roles"] = []string{"tenant", "bogus", "operator"}
+	claims["scope"] = "read snapshot"
+	claims[claimVolumes] = []string{"vol-1"}
+	claims["jti"] = "tok-1"
+	id, err := p.Authenticate(signJWT(t, map[string]interface{}{"alg": AlgHS256}, claims, secret))
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if id.Principal != "svc" || id.Role != RoleOperator || id.TokenID != "tok-1" ||
+		!slices.Equal(id.Scopes, []string{"read", "snapshot"}) || !slices.Equal(id.Volumes, []string{"vol-1"}) {
+		t.Fatalf("identity = %+v", id)
+	}
+
+	claims["aud"] = "other"
+	expectInvalid(t, p, signJWT(t, map[string]interface{}{"alg": AlgHS256}, claims, secret), "audience")
+}
+
+func TestJWTAlgorithmAndKeyMismatch(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestJWTProvider(t, JWTConfig{Keys: []JWTKey{
+		{ID: "hmac", Key: secret},
+		{ID: "ed", Key: edPub},
+	}})
+	claims := claimsFor("svc", time.Hour)
+
+	for _, header := range []map[string]interface{}{
+		{"alg": AlgHS256},
+		{"alg": AlgHS256, "kid": "hmac"},
+	} {
+		if _, err := p.Authenticate(signJWT(t, header, claims, secret)); err != nil {
+			t.Fatalf("Authenticate with %v: %v", header, err)
+		}
+	}
+	if _, err := p.Authenticate(signJWT(t, map[string]interface{}{"alg": AlgEdDSA, "kid": "ed"}, claims, edPriv)); err != nil {
+		t.Fatalf("Authenticate EdDSA: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		header map[string]interface{}
+		key    interface{}
+	}{
+		{"kid names another key", map[string]interface{}{"alg": AlgHS256, "kid": "ed"}, secret},
+		{"unknown kid", map[string]interface{}{"alg": AlgHS256, "kid": "gone"}, secret},
+		{"alg does not match signature", map[string]interface{}{"alg": AlgEdDSA}, secret},
+		{"public key used as HMAC secret", map[string]interface{}{"alg": AlgHS256, "kid": "ed"}, []byte(edPub)},
+		{"alg none", map[string]interface{}{"alg": "none"}, secret},
+		{"alg of no configured key", map[string]interface{}{"alg": AlgES256}, secret},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			expectInvalid(t, p, signJWT(t, tc.header, claims, tc.key), "signature not verified")
+		})
+	}
+}
+
+func TestJWTExpiry(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	header := map[string]interface{}{"alg": AlgHS256}
+	strict := newTestJWTProvider(t, JWTConfig{Keys: []JWTKey{{Key: secret}}})
+	lenient := newTestJWTProvider(t, JWTConfig{Keys: []JWTKey{{Key: secret}}, Leeway: time.Minute})
+
+	expired := signJWT(t, header, claimsFor("svc", -30*time.Second), secret)
+	expectInvalid(t, strict, expired, "token expired")
+	if _, err := lenient.Authenticate(expired); err != nil {
+		t.Fatalf("expiry within leeway: %v", err)
+	}
+	expectInvalid(t, lenient, signJWT(t, header, claimsFor("svc", -2*time.Minute), secret), "token expired")
+	expectInvalid(t, strict, signJWT(t, header, map[string]interface{}{"sub": "svc"}, secret), "missing exp")
+}
+
+func TestJWTNotBeforeLeeway(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	header := map[string]interface{}{"alg": AlgHS256}
+	strict := newTestJWTProvider(t, JWTConfig{Keys: []JWTKey{{Key: secret}}})
+	lenient := newTestJWTProvider(t, JWTConfig{Keys: []JWTKey{{Key: secret}}, Leeway: time.Minute})
+
+	claims := claimsFor("svc", time.Hour)
+	claims["nbf"] = jwtNow.Add(30 * time.Second).Unix()
+	early := signJWT(t, header, claims, secret)
+	expectInvalid(t, strict, early, "not yet valid")
+	if _, err := lenient.Authenticate(early); err != nil {
+		t.Fatalf("nbf within leeway: %v", err)
+	}
+
+	claims["nbf"] = jwtNow.Add(2 * time.Minute).Unix()
+	expectInvalid(t, lenient, signJWT(t, header, claims, secret), "not yet valid")
+	claims["nbf"] = "soon"
+	expectInvalid(t, lenient, signJWT(t, header, claims, secret), "malformed nbf")
+}
+
+// TestJWTES256SignatureLength checks that only the fixed 64 byte r||s
+// encoding is accepted.
+func TestJWTES256SignatureLength(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestJWTProvider(t, JWTConfig{Keys: []JWTKey{{Key: &key.PublicKey}}})
+	token := signJWT(t, map[string]interface{}{"alg": AlgES256}, claimsFor("svc", time.Hour), key)
+	if _, err := p.Authenticate(token); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	dot := strings.LastIndex(token, ".")
+	sig := mustDecode(t, token[dot+1:])
+	for _, bad := range [][]byte{sig[:63], append(slices.Clone(sig), 0), append([]byte{0}, sig...)} {
+		expectInvalid(t, p, token[:dot+1]+b64.EncodeToString(bad), "signature not verified")
+	}
+}
+
+func TestNewJWTProviderRejectsWeakKeys(t *testing.T) {
+	if _, err := NewJWTProvider(JWTConfig{Keys: []JWTKey{{Key: []byte("short")}}}); err == nil {
+		t.Fatal("accepted a short HS256 secret")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJWTProvider(JWTConfig{Keys: []JWTKey{{Key: &key.PublicKey}}}); err == nil {
+		t.Fatal("accepted a P-384 key")
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import "fmt"
+
+// Role is the level of access a principal has across all tenants.
+type Role string
+
+const (
+	// RoleAdmin sees and manages everything and may use administrative
+	// overrides such as force detach.
+	RoleAdmin Role = "admin"
+	// RoleOperator sees and manages every tenant's resources but cannot use
+	// administrative overrides.
+	RoleOperator Role = "operator"
+	// RoleTenant is confined to its own resources and those shared with it.
+	RoleTenant Role = "tenant"
+	// RoleAuditor may read every resource and the audit log but change
+	// nothing.
+	RoleAuditor Role = "auditor"
+)
+
+// ParseRole validates a role name. The empty string is a tenant.
+func ParseRole(name string) (Role, error) {
+	switch role := Role(name); role {
+	case "":
+		return RoleTenant, nil
+	case RoleAdmin, RoleOperator, RoleTenant, RoleAuditor:
+		return role, nil
+	default:
+		return "", fmt.Errorf("unknown role %q", name)
+	}
+}
+
+// rank orders roles by privilege for callers that present several.
+func (r Role) rank() int {
+	switch r {
+	case RoleAdmin:
+		return 3
+	case RoleOperator:
+		return 2
+	case RoleAuditor:
+		return 1
+	}
+	return 0
+}
@@ -4,42 +4,109 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sync"
 )
 
-// TokenProvider resolves principals for bearer tokens.
-type TokenProvider interface {
-	Principal(token string) (string, bool)
-}
-
-// StaticProvider loads tokens from a JSON map file {"token":"principal"}.
+// StaticProvider loads tokens from a JSON map file. Each token maps either to
+// a principal name, which is a tenant, or to an object naming the principal
+// and its role:
+//
+//	{"token1": "service:app1", "token2": {"principal": "user:ops", "role": "admin"}}
+//
+// Reload swaps in a new copy of the file.
 type StaticProvider struct {
+	path    string
+	mu      sync.RWMutex
 	byToken map[string]string
+	roles   map[string]Role
+}
+
+type tokenEntry struct {
+	Principal string `json:"principal"`
+	Role      string `json:"role,omitempty"`
 }
 
 // NewStaticProvider constructs a provider from a path.
 func NewStaticProvider(path string) (*StaticProvider, error) {
+	byToken, roles, err := loadTokenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticProvider{path: path, byToken: byToken, roles: roles}, nil
+}
+
+// Reload re-reads the token file and replaces every token at once. When the
+// file does not load, the current tokens are kept and the error returned.
+func (s *StaticProvider) Reload() error {
+	byToken, roles, err := loadTokenFile(s.path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byToken, s.roles = byToken, roles
+	return nil
+}
+
+func loadTokenFile(path string) (map[string]string, map[string]Role, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("read token file: %w", err)
+		return nil, nil, fmt.Errorf("read token file: %w", err)
 	}
-	raw := map[string]string{}
+	raw := map[string]json.RawMessage{}
 	if err := json.Unmarshal(data, &raw); err != nil {
-		return nil, fmt.Errorf("parse token file: %w", err)
+		return nil, nil, fmt.Errorf("parse token file: %w", err)
 	}
 	if len(raw) == 0 {
-		return nil, fmt.Errorf("token file contained no entries")
+		return nil, nil, fmt.Errorf("token file contained no entries")
 	}
-	return &StaticProvider{byToken: raw}, nil
+	byToken, roles := make(map[string]string, len(raw)), map[string]Role{}
+	for token, value := range raw {
+		var entry tokenEntry
+		if err := json.Unmarshal(value, &entry.Principal); err != nil {
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return nil, nil, fmt.Errorf("parse token file: entry must be a principal or an object: %w", err)
+			}
+		}
+		if entry.Principal == "" {
+			return nil, nil, fmt.Errorf("parse token file: entry without principal")
+		}
+		byToken[token] = entry.Principal
+		if entry.Role == "" {
+			continue
+		}
+		role, err := ParseRole(entry.Role)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse token file: principal %s: %w", entry.Principal, err)
+		}
+		if existing, ok := roles[entry.Principal]; ok && existing != role {
+			return nil, nil, fmt.Errorf("parse token file: principal %s has conflicting roles %s and %s", entry.Principal, existing, role)
+		}
+		roles[entry.Principal] = role
+	}
+	return byToken, roles, nil
 }
 
-// Principal returns the associated principal for a token.
-func (s *StaticProvider) Principal(token string) (string, bool) {
+// Authenticate implements TokenProvider. Principals without a role in the
+// file are tenants.
+func (s *StaticProvider) Authenticate(token string) (Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	principal, ok := s.byToken[token]
-	return principal, ok
+	if !ok {
+		return Identity{}, ErrUnknownToken
+	}
+	role, ok := s.roles[principal]
+	if !ok {
+		role = RoleTenant
+	}
+	return Identity{Principal: principal, Role: role}, nil
 }
 
 // Size returns the number of configured tokens.
 func (s *StaticProvider) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return len(s.byToken)
 }
 
@@ -57,8 +124,11 @@ func NewInMemory(mapping map[string]string) *InMemoryProvider {
 	return &InMemoryProvider{byToken: cp}
 }
 
-// Principal implements TokenProvider.
-func (m *InMemoryProvider) Principal(token string) (string, bool) {
+// Authenticate implements TokenProvider. Every principal is a tenant.
+func (m *InMemoryProvider) Authenticate(token string) (Identity, error) {
 	principal, ok := m.byToken[token]
-	return principal, ok
+	if !ok {
+		return Identity{}, ErrUnknownToken
+	}
+	return Identity{Principal: principal, Role: RoleTenant}, nil
 }
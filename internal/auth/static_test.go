@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticProviderReloadKeepsTokensOnBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"old": "svc", "ops": {"principal": "user:ops", "role": "operator"}}`)
+	p, err := NewStaticProvider(path)
+	if err != nil {
+		t.Fatalf("NewStaticProvider: %v", err)
+	}
+
+	for _, bad := range []string{`{"old": `, `{}`, `{"x": {"principal": "svc", "role": "root"}}`} {
+		write(bad)
+		if err := p.Reload(); err == nil {
+			t.Fatalf("Reload accepted %s", bad)
+		}
+		if id, err := p.Authenticate("old"); err != nil || id.Principal != "svc" {
+			t.Fatalf("after bad reload of %s: %+v, %v", bad, id, err)
+		}
+	}
+
+	write(`{"new": {"principal": "svc", "role": "auditor"}}`)
+	if err := p.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, err := p.Authenticate("old"); !errors.Is(err, ErrUnknownToken) {
+		t.Fatalf("removed token still authenticates: %v", err)
+	}
+	id, err := p.Authenticate("new")
+	if err != nil || id.Role != RoleAuditor {
+		t.Fatalf("new token: %+v, %v", id, err)
+	}
+	if p.Size() != 1 {
+		t.Fatalf("Size = %d, want 1", p.Size())
+	}
+}
@@ -0,0 +1,73 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const auditActionACLUpdate = "volume.acl-update"
+
+type aclDocument struct {
+	Entries []store.ACLEntry `json:"entries"`
+}
+
+func newACLDocument(v store.Volume) aclDocument {
+	if v.ACL == nil {
+		return aclDocument{Entries: []store.ACLEntry{}}
+	}
+	return aclDocument{Entries: v.ACL}
+}
+
+func (s *Server) handleGetACL(w http.ResponseWriter, r *http.Request) {
+	_, vol, ok := s.authorizeVolume(w, r, chi.URLParam(r, "volumeID"), store.VerbManage)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, newACLDocument(vol))
+}
+
+// handlePutACL replaces the volume's ACL. An empty list stops sharing the
+// volume.
+func (s *Server) handlePutACL(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	var req aclDocument
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	principal, _, ok := s.authorizeVolume(w, r, id, store.VerbManage)
+	if !ok {
+		return
+	}
+
+	var previous store.Volume
+	persisted, err := s.store.UpdateVolume(id, func(v *store.Volume) error {
+		previous = *v
+		if err := store.ValidateACL(v.OwnerPrincipal, req.Entries); err != nil {
+			return err
+		}
+		v.ACL = nil
+		if len(req.Entries) > 0 {
+			v.ACL = req.Entries
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, store.ErrInvalidACL):
+		respondError(w, http.StatusBadRequest, "invalid_acl", err.Error())
+		return
+	case err != nil:
+		respondVolumeError(w, err)
+		return
+	}
+
+	s.recordAudit(principal, auditActionACLUpdate, id, map[string]interface{}{
+		"from": previous.ACL,
+		"to":   persisted.ACL,
+	})
+	respondJSON(w, http.StatusOK, newACLDocument(persisted))
+}
@@ -0,0 +1,239 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/archive"
+	"github.com/AtDexters-Lab/aionFS/internal/ids"
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+	"github.com/AtDexters-Lab/aionFS/internal/policy"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+// archiveMetadataAllowance is the room left for manifest, volume and snapshot
+// records on top of the capsule limit when reading an imported archive.
+const archiveMetadataAllowance = 8 << 20
+
+type importResponse struct {
+	Checkpoint  store.Checkpoint  `json:"checkpoint"`
+	VolumeMap   map[string]string `json:"volume_map"`
+	SnapshotMap map[string]string `json:"snapshot_map"`
+}
+
+func (s *Server) handleExportArchive(w http.ResponseWriter, r *http.Request) {
+	cp, ok := s.loadCheckpoint(w, r)
+	if !ok {
+		return
+	}
+
+	bundle := archive.Bundle{Checkpoint: cp}
+	seenVolumes := map[string]bool{}
+	for _, sid := range cp.SnapshotIDs {
+		snap, err := s.store.GetSnapshot(sid)
+		if err != nil {
+			respondError(w, http.StatusConflict, "missing_snapshot", fmt.Sprintf("checkpoint references missing snapshot %s", sid))
+			return
+		}
+		bundle.Snapshots = append(bundle.Snapshots, snap)
+		if seenVolumes[snap.VolumeID] {
+			continue
+		}
+		vol, err := s.store.GetVolume(snap.VolumeID)
+		if err != nil {
+			respondError(w, http.StatusConflict, "missing_volume", fmt.Sprintf("source volume %s for snapshot %s no longer exists", snap.VolumeID, sid))
+			return
+		}
+		seenVolumes[snap.VolumeID] = true
+		bundle.Volumes = append(bundle.Volumes, archive.VolumeOf(vol))
+	}
+	if cp.Capsule != nil {
+		_, data, err := s.store.ReadCapsule(cp.ManifestID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+			return
+		}
+		bundle.Capsule = data
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", cp.ManifestID+".tar"))
+	w.WriteHeader(http.StatusOK)
+	if err := archive.Write(w, bundle); err != nil {
+		// Headers are already on the wire; the truncated tar fails validation
+		// on import.
+		log.Printf("export archive %s: %v", cp.ManifestID, err)
+	}
+}
+
+func (s *Server) handleImportArchive(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+	if tokenRestricted(r.Context()) {
+		respondError(w, http.StatusForbidden, "token_restricted", "token is limited to existing volumes")
+		return
+	}
+
+	bundle, _, err := archive.Read(r.Body, s.capsuleLimit+archiveMetadataAllowance)
+	if err != nil {
+		if errors.Is(err, archive.ErrInvalid) {
+			respondError(w, http.StatusBadRequest, "invalid_archive", err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "archive_error", err.Error())
+		return
+	}
+	if bundle.Capsule != nil && int64(len(bundle.Capsule)) > s.capsuleLimit {
+		respondCapsuleTooLarge(w, s.capsuleLimit)
+		return
+	}
+
+	volumeMap := make(map[string]string, len(bundle.Volumes))
+	vols := make([]store.Volume, 0, len(bundle.Volumes))
+	for _, src := range bundle.Volumes {
+		// Imported volumes are held to the same rules as created ones.
+		if src.Name != "" && !store.ValidName(src.Name) {
+			respondError(w, http.StatusBadRequest, "invalid_name", fmt.Sprintf("volume %s: name must be at most 63 lowercase letters, digits and dashes", src.VolumeID))
+			return
+		}
+		if src.QuotaBytes < 0 {
+			respondError(w, http.StatusBadRequest, "invalid_quota", fmt.Sprintf("volume %s: quota_bytes must not be negative", src.VolumeID))
+			return
+		}
+		if !validateMetadata(w, src.Labels, src.Annotations) {
+			return
+		}
+		exportMode := src.ExportMode
+		if exportMode == "" {
+			exportMode = store.ExportFS
+		}
+		if !store.ValidExportMode(exportMode) {
+			respondError(w, http.StatusBadRequest, "invalid_export_mode", fmt.Sprintf("volume %s: unsupported export mode %q", src.VolumeID, src.ExportMode))
+			return
+		}
+		id := ids.New(ids.Volume)
+		volumeMap[src.VolumeID] = id
+		owner := src.OwnerPrincipal
+		if s.authEnabled() {
+			owner = principal
+		}
+		// Archives written before access modes existed carry none.
+		accessMode := src.AccessMode
+		if !store.ValidAccessMode(accessMode) {
+			accessMode = store.AccessSingleWriter
+		}
+		// Classes were not validated when older archives were written.
+		class := src.Class
+		if !store.ValidClass(class) {
+			class = store.ClassPersistent
+		}
+		// The profile must exist here too; older archives may carry none.
+		profile := src.PolicyProfile
+		if profile == "" {
+			profile = policy.DefaultProfile
+		}
+		eff, err := s.store.ResolvePolicy(profile)
+		if err != nil {
+			respondPolicyError(w, err)
+			return
+		}
+		if !quotaAllowed(eff.Policy, src.QuotaBytes) {
+			respondQuotaExceedsPolicy(w, eff)
+			return
+		}
+		vols = append(vols, store.Volume{
+			VolumeID:         id,
+			Name:             src.Name,
+			OwnerPrincipal:   owner,
+			Class:            class,
+			QuotaBytes:       src.QuotaBytes,
+			ProvisionedBytes: src.QuotaBytes,
+			PolicyProfile:    profile,
+			Policy:           &eff.Policy,
+			ExportMode:       exportMode,
+			AccessMode:       accessMode,
+			Labels:           src.Labels,
+			Annotations:      src.Annotations,
+			ExpiresAt:        s.ephemeralExpiry(class, 0),
+			MountHandle:      newMountInfo(id, exportMode, lifecycle.Available),
+			AttachState:      lifecycle.Available,
+			RestoredFrom:     src.RestoredFrom,
+			Transitions: []lifecycle.Transition{
+				lifecycle.Initial(lifecycle.Available, "imported from archive "+bundle.Checkpoint.ManifestID, owner),
+			},
+		})
+	}
+
+	snapshotMap := make(map[string]string, len(bundle.Snapshots))
+	snaps := make([]store.Snapshot, 0, len(bundle.Snapshots))
+	for _, src := range bundle.Snapshots {
+		if !validateMetadata(w, src.Labels, src.Annotations) {
+			return
+		}
+		id := ids.New(ids.Snapshot)
+		snapshotMap[src.SnapshotID] = id
+		snaps = append(snaps, store.Snapshot{
+			SnapshotID:  id,
+			VolumeID:    volumeMap[src.VolumeID],
+			CreatedAt:   src.CreatedAt,
+			Note:        src.Note,
+			Labels:      src.Labels,
+			Annotations: src.Annotations,
+		})
+	}
+	for i := range vols {
+		if vols[i].RestoredFrom != "" {
+			vols[i].RestoredFrom = snapshotMap[vols[i].RestoredFrom]
+		}
+	}
+
+	src := bundle.Checkpoint
+	if !validateMetadata(w, src.Labels, src.Annotations) {
+		return
+	}
+	snapshotIDs := make([]string, 0, len(src.SnapshotIDs))
+	for _, sid := range src.SnapshotIDs {
+		snapshotIDs = append(snapshotIDs, snapshotMap[sid])
+	}
+	owner := src.OwnerPrincipal
+	if s.authEnabled() {
+		owner = principal
+	}
+	manifest := store.Checkpoint{
+		ManifestID:       ids.New(ids.Checkpoint),
+		SnapshotIDs:      snapshotIDs,
+		CreatedAt:        time.Now().UTC(),
+		Note:             src.Note,
+		Consistency:      src.Consistency,
+		CaptureSkewNanos: src.CaptureSkewNanos,
+		OwnerPrincipal:   owner,
+		Labels:           src.Labels,
+		Annotations:      src.Annotations,
+	}
+	capsuleType := ""
+	if src.Capsule != nil {
+		capsuleType = src.Capsule.ContentType
+	}
+
+	persisted, err := s.store.ImportCheckpoint(vols, snaps, manifest, capsuleType, bundle.Capsule)
+	if errors.Is(err, store.ErrPoolExhausted) || errors.Is(err, store.ErrNameTaken) || errors.Is(err, store.ErrIDConflict) {
+		respondVolumeError(w, err)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, importResponse{
+		Checkpoint:  persisted,
+		VolumeMap:   volumeMap,
+		SnapshotMap: snapshotMap,
+	})
+}
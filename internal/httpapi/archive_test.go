@@ -0,0 +1,155 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/AtDexters-Lab/aionFS/internal/archive"
+	"github.com/AtDexters-Lab/aionFS/internal/policy"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+// archiveOf returns an archive holding a checkpoint of vol.
+func archiveOf(t *testing.T, vol store.Volume) string {
+	t.Helper()
+	vol.VolumeID = "vol-src"
+	var buf bytes.Buffer
+	err := archive.Write(&buf, archive.Bundle{
+		Checkpoint: store.Checkpoint{ManifestID: "chk-src", SnapshotIDs: []string{"snap-src"}},
+		Volumes:    []archive.Volume{archive.VolumeOf(vol)},
+		Snapshots:  []store.Snapshot{{SnapshotID: "snap-src", VolumeID: vol.VolumeID}},
+	})
+	if err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	return buf.String()
+}
+
+// TestImportValidatesVolumes checks that imported volumes are held to the
+// rules that apply when creating them.
+func TestImportValidatesVolumes(t *testing.T) {
+	s, st := newTestServer(t, nil)
+	h := s.Router()
+	limit := int64(1 << 20)
+	if _, err := st.PutProfile(policy.Profile{Name: "small", Settings: policy.Settings{MaxQuotaBytes: &limit}}, true); err != nil {
+		t.Fatalf("put profile: %v", err)
+	}
+	st.SetPoolCapacity(store.ClassPersistent, 4<<20)
+
+	cases := []struct {
+		name string
+		vol  store.Volume
+		want int
+		code string
+	}{
+		{"bad name", store.Volume{Name: "Not_Valid", QuotaBytes: 1 << 10}, http.StatusBadRequest, "invalid_name"},
+		{"bad label", store.Volume{QuotaBytes: 1 << 10, Labels: map[string]string{"bad key!": "x"}}, http.StatusBadRequest, "invalid_labels"},
+		{"negative quota", store.Volume{QuotaBytes: -1 << 30}, http.StatusBadRequest, "invalid_quota"},
+		{"over policy", store.Volume{PolicyProfile: "small", QuotaBytes: 2 << 20}, http.StatusBadRequest, "quota_exceeds_policy"},
+		{"over pool", store.Volume{QuotaBytes: 8 << 20}, http.StatusInsufficientStorage, "pool_exhausted"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.vol.OwnerPrincipal = "svc"
+			rec := request(t, h, http.MethodPost, "/v1/checkpoints:import", archiveOf(t, tc.vol))
+			expectStatus(t, rec, tc.want)
+			if code := decodeBody[errorResponse](t, rec).Error; code != tc.code {
+				t.Fatalf("error = %q, want %q", code, tc.code)
+			}
+		})
+	}
+
+	pinned := policy.Policy{MaxQuotaBytes: 1 << 40}
+	rec := request(t, h, http.MethodPost, "/v1/checkpoints:import", archiveOf(t, store.Volume{
+		OwnerPrincipal: "svc",
+		PolicyProfile:  "small",
+		QuotaBytes:     1 << 20,
+		Policy:         &pinned,
+	}))
+	expectStatus(t, rec, http.StatusCreated)
+	res := decodeBody[importResponse](t, rec)
+	vol, err := st.GetVolume(res.VolumeMap["vol-src"])
+	if err != nil {
+		t.Fatalf("imported volume: %v", err)
+	}
+	if vol.Policy == nil || vol.Policy.MaxQuotaBytes != limit {
+		t.Fatalf("policy = %+v, want the local profile's", vol.Policy)
+	}
+	if vol.ProvisionedBytes != 1<<20 {
+		t.Fatalf("provisioned = %d, want %d", vol.ProvisionedBytes, 1<<20)
+	}
+}
+
+// TestExportOmitsVolumeState checks that archives carry only what an import
+// needs from each volume.
+func TestExportOmitsVolumeState(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	h := s.Router()
+	vol := createVolume(t, h, "svc")
+	attach(t, h, vol.VolumeID, "svc", "sess-1")
+
+	rec := request(t, h, http.MethodPost, "/v1/checkpoints", createCheckpointRequest{VolumeIDs: []string{vol.VolumeID}})
+	expectStatus(t, rec, http.StatusCreated)
+	cp := decodeBody[store.Checkpoint](t, rec)
+
+	rec = request(t, h, http.MethodGet, "/v1/checkpoints/"+cp.ManifestID+"/archive", nil)
+	expectStatus(t, rec, http.StatusOK)
+	for _, field := range []string{"attach_sessions", "fencing_generation", "transitions", "mount_handle"} {
+		if strings.Contains(rec.Body.String(), `"`+field+`"`) {
+			t.Fatalf("archive carries %s", field)
+		}
+	}
+	bundle, _, err := archive.Read(rec.Body, 1<<20)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	if len(bundle.Volumes) != 1 || bundle.Volumes[0].VolumeID != vol.VolumeID || bundle.Volumes[0].QuotaBytes != vol.QuotaBytes {
+		t.Fatalf("volumes = %+v", bundle.Volumes)
+	}
+}
+
+func TestImportRejectsInvalidRecords(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	h := s.Router()
+
+	write := func(b archive.Bundle) string {
+		var buf bytes.Buffer
+		if err := archive.Write(&buf, b); err != nil {
+			t.Fatalf("write archive: %v", err)
+		}
+		return buf.String()
+	}
+	vol := archive.Volume{VolumeID: "vol-src", OwnerPrincipal: "svc", QuotaBytes: 1 << 10}
+	cases := []struct {
+		name   string
+		bundle archive.Bundle
+		code   string
+	}{
+		{"duplicate volume", archive.Bundle{
+			Checkpoint: store.Checkpoint{ManifestID: "chk-src", SnapshotIDs: []string{"snap-src"}},
+			Volumes:    []archive.Volume{vol, vol},
+			Snapshots:  []store.Snapshot{{SnapshotID: "snap-src", VolumeID: "vol-src"}},
+		}, "invalid_archive"},
+		{"duplicate snapshot", archive.Bundle{
+			Checkpoint: store.Checkpoint{ManifestID: "chk-src", SnapshotIDs: []string{"snap-src", "snap-src"}},
+			Volumes:    []archive.Volume{vol},
+			Snapshots:  []store.Snapshot{{SnapshotID: "snap-src", VolumeID: "vol-src"}, {SnapshotID: "snap-src", VolumeID: "vol-src"}},
+		}, "invalid_archive"},
+		{"unknown export mode", archive.Bundle{
+			Checkpoint: store.Checkpoint{ManifestID: "chk-src", SnapshotIDs: []string{"snap-src"}},
+			Volumes:    []archive.Volume{{VolumeID: "vol-src", OwnerPrincipal: "svc", ExportMode: "iscsi"}},
+			Snapshots:  []store.Snapshot{{SnapshotID: "snap-src", VolumeID: "vol-src"}},
+		}, "invalid_export_mode"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := request(t, h, http.MethodPost, "/v1/checkpoints:import", write(tc.bundle))
+			expectStatus(t, rec, http.StatusBadRequest)
+			if code := decodeBody[errorResponse](t, rec).Error; code != tc.code {
+				t.Fatalf("error = %q, want %q", code, tc.code)
+			}
+		})
+	}
+}
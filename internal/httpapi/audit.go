@@ -0,0 +1,50 @@
+package httpapi
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/AtDexters-Lab/aionFS/internal/auth"
+	"github.com/AtDexters-Lab/aionFS/internal/ids"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+// recordAudit appends an audit event. Failures are logged; the change being
+// audited has already been applied.
+func (s *Server) recordAudit(principal, action, target string, details map[string]interface{}) {
+	_, err := s.store.AppendAudit(store.AuditEvent{
+		EventID:   ids.New(ids.Event),
+		Principal: principal,
+		Action:    action,
+		Target:    target,
+		Details:   details,
+	})
+	if err != nil {
+		log.Printf("audit %s on %s: %v", action, target, err)
+	}
+}
+
+// handleListAudit returns audit events, optionally filtered by action and
+// target. Only admins and auditors may read the audit log.
+func (s *Server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	_, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+	if !s.isAdmin(r.Context()) && roleOf(r.Context()) != auth.RoleAuditor {
+		respondError(w, http.StatusForbidden, "admin_required", "audit log requires an admin or auditor principal")
+		return
+	}
+
+	query := r.URL.Query()
+	action, target := query.Get("action"), query.Get("target")
+	events := make([]store.AuditEvent, 0)
+	for _, ev := range s.store.ListAudit() {
+		if (action != "" && ev.Action != action) || (target != "" && ev.Target != target) {
+			continue
+		}
+		events = append(events, ev)
+	}
+	respondJSON(w, http.StatusOK, events)
+}
@@ -0,0 +1,115 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/AtDexters-Lab/aionFS/internal/auth"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+// roleOf returns the caller's role. requireAuth promotes principals passed to
+// WithAdmins to admin; everyone else has the role their token carries.
+func roleOf(ctx context.Context) auth.Role {
+	id, ok := identityFromContext(ctx)
+	if !ok || id.Role == "" {
+		return auth.RoleTenant
+	}
+	return id.Role
+}
+
+// seesAll reports whether the caller may read every tenant's resources.
+// Without token auth every caller is trusted.
+func (s *Server) seesAll(ctx context.Context) bool {
+	if !s.authEnabled() {
+		return true
+	}
+	switch roleOf(ctx) {
+	case auth.RoleAdmin, auth.RoleOperator, auth.RoleAuditor:
+		return true
+	}
+	return false
+}
+
+// managesAll reports whether the caller may change every tenant's resources.
+func (s *Server) managesAll(ctx context.Context) bool {
+	if !s.authEnabled() {
+		return true
+	}
+	switch roleOf(ctx) {
+	case auth.RoleAdmin, auth.RoleOperator:
+		return true
+	}
+	return false
+}
+
+// authorized is the single check deciding whether the caller may perform verb
+// on a volume. Restrictions carried by the token apply first. Then admins and
+// operators may do anything and auditors may read.
+// Otherwise the owner may do anything and other principals need a matching
+// ACL entry. Without token auth every caller is trusted.
+func (s *Server) authorized(ctx context.Context, v store.Volume, verb string) bool {
+	if !tokenAllows(ctx, v, verb) {
+		return false
+	}
+	if s.managesAll(ctx) || (verb == store.VerbRead && s.seesAll(ctx)) {
+		return true
+	}
+	principal, _ := principalFromContext(ctx)
+	return v.Allows(principal, verb)
+}
+
+// tokenAllows applies the restrictions of a scoped token: it may only touch
+// the volumes it names and, when its scopes include volume verbs, only use
+// those verbs.
+func tokenAllows(ctx context.Context, v store.Volume, verb string) bool {
+	id, ok := identityFromContext(ctx)
+	if !ok {
+		return true
+	}
+	if len(id.Volumes) > 0 && !slices.Contains(id.Volumes, v.VolumeID) {
+		return false
+	}
+	scoped := slices.ContainsFunc(id.Scopes, store.KnownVerb)
+	return !scoped || store.VerbsAllow(id.Scopes, verb)
+}
+
+// tokenRestricted reports whether the caller's token is limited to named
+// volumes. Such a token may not bring new volumes into being.
+func tokenRestricted(ctx context.Context) bool {
+	id, _ := identityFromContext(ctx)
+	return len(id.Volumes) > 0
+}
+
+// authorizeVolume loads the volume and checks that the caller may perform
+// verb on it, writing an error response otherwise.
+func (s *Server) authorizeVolume(w http.ResponseWriter, r *http.Request, id, verb string) (string, store.Volume, bool) {
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return "", store.Volume{}, false
+	}
+	vol, err := s.store.GetVolume(id)
+	if err != nil {
+		respondVolumeError(w, err)
+		return "", store.Volume{}, false
+	}
+	if !s.authorized(r.Context(), vol, verb) {
+		respondForbidden(w, verb)
+		return "", store.Volume{}, false
+	}
+	return principal, vol, true
+}
+
+func respondForbidden(w http.ResponseWriter, verb string) {
+	respondError(w, http.StatusForbidden, "principal_mismatch", fmt.Sprintf("principal not authorised for %s on this volume", verb))
+}
+
+// holdsSession reports whether the caller may renew or release a session: the
+// principal it was attached for, or anyone who may manage the volume.
+func (s *Server) holdsSession(ctx context.Context, v store.Volume, session store.Session) bool {
+	principal, _ := principalFromContext(ctx)
+	return session.Principal == principal || s.authorized(ctx, v, store.VerbManage)
+}
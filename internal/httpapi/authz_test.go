@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/AtDexters-Lab/aionFS/internal/auth"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+// TestRestrictedTokenCannotImport checks that a token limited to existing
+// volumes cannot bring new ones in through an archive either.
+func TestRestrictedTokenCannotImport(t *testing.T) {
+	tokens := tokenTable{
+		"owner":      {Principal: "svc", Role: auth.RoleTenant},
+		"restricted": {Principal: "svc", Role: auth.RoleTenant, Volumes: []string{"vol-x"}},
+	}
+	s, _ := newTestServer(t, tokens)
+	h := s.Router()
+
+	rec := request(t, h, http.MethodPost, "/v1/volumes", map[string]interface{}{"quota_bytes": 1 << 20}, bearer("restricted")...)
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = request(t, h, http.MethodPost, "/v1/checkpoints:import", "not an archive", bearer("restricted")...)
+	expectStatus(t, rec, http.StatusForbidden)
+	if code := decodeBody[errorResponse](t, rec).Error; code != "token_restricted" {
+		t.Fatalf("error = %q, want token_restricted", code)
+	}
+
+	rec = request(t, h, http.MethodPost, "/v1/checkpoints:import", "not an archive", bearer("owner")...)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+// TestByNameLookupHonoursTokenRestrictions checks that looking a volume up
+// by name applies the same read check as looking it up by ID.
+func TestByNameLookupHonoursTokenRestrictions(t *testing.T) {
+	tokens := tokenTable{"owner": {Principal: "svc", Role: auth.RoleTenant}}
+	s, _ := newTestServer(t, tokens)
+	h := s.Router()
+
+	vols := make(map[string]string)
+	for _, name := range []string{"alpha", "beta"} {
+		rec := request(t, h, http.MethodPost, "/v1/volumes", map[string]interface{}{
+			"name":        name,
+			"quota_bytes": 1 << 20,
+		}, bearer("owner")...)
+		expectStatus(t, rec, http.StatusCreated)
+		vols[name] = decodeBody[store.Volume](t, rec).VolumeID
+	}
+	tokens["restricted"] = auth.Identity{Principal: "svc", Role: auth.RoleTenant, Volumes: []string{vols["alpha"]}}
+
+	rec := request(t, h, http.MethodGet, "/v1/volumes/by-name/alpha", nil, bearer("restricted")...)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decodeBody[store.Volume](t, rec).VolumeID; got != vols["alpha"] {
+		t.Fatalf("volume = %s, want %s", got, vols["alpha"])
+	}
+	rec = request(t, h, http.MethodGet, "/v1/volumes/by-name/beta", nil, bearer("restricted")...)
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = request(t, h, http.MethodGet, "/v1/volumes/"+vols["beta"], nil, bearer("restricted")...)
+	expectStatus(t, rec, http.StatusForbidden)
+}
+
+// TestTransferAcceptHonoursTokenScopes checks that the target of a transfer
+// needs a token that may manage the volume to accept or decline it.
+func TestTransferAcceptHonoursTokenScopes(t *testing.T) {
+	tokens := tokenTable{
+		"owner":        {Principal: "svc", Role: auth.RoleTenant},
+		"target":       {Principal: "other", Role: auth.RoleTenant},
+		"target-read":  {Principal: "other", Role: auth.RoleTenant, Scopes: []string{store.VerbRead}},
+		"target-other": {Principal: "other", Role: auth.RoleTenant, Volumes: []string{"vol-x"}},
+	}
+	s, _ := newTestServer(t, tokens)
+	h := s.Router()
+	vol := createVolume(t, h, "svc", bearer("owner")...)
+	path := "/v1/volumes/" + vol.VolumeID + "/transfer"
+
+	rec := request(t, h, http.MethodPost, path, transferRequest{ToPrincipal: "other"}, bearer("owner")...)
+	expectStatus(t, rec, http.StatusAccepted)
+	for _, token := range []string{"target-read", "target-other"} {
+		rec = request(t, h, http.MethodPost, path+"/accept", nil, bearer(token)...)
+		expectStatus(t, rec, http.StatusForbidden)
+		rec = request(t, h, http.MethodDelete, path, nil, bearer(token)...)
+		expectStatus(t, rec, http.StatusForbidden)
+	}
+
+	rec = request(t, h, http.MethodPost, path+"/accept", nil, bearer("target")...)
+	expectStatus(t, rec, http.StatusOK)
+	if owner := decodeBody[store.Volume](t, rec).OwnerPrincipal; owner != "other" {
+		t.Fatalf("owner = %q, want other", owner)
+	}
+}
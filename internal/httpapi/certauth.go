@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/auth"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// AuthMode selects which credentials requireAuth accepts.
+type AuthMode string
+
+const (
+	// AuthToken requires a bearer token. Client certificates are not used
+	// for identity.
+	AuthToken AuthMode = "token"
+	// AuthCert requires a mapped client certificate. Bearer tokens are
+	// ignored.
+	AuthCert AuthMode = "cert"
+	// AuthEither accepts a bearer token or a mapped client certificate. When
+	// both are presented they must name the same principal.
+	AuthEither AuthMode = "either"
+	// AuthBoth requires a bearer token and a mapped client certificate
+	// naming the same principal.
+	AuthBoth AuthMode = "both"
+)
+
+// ParseAuthMode validates a mode name.
+func ParseAuthMode(s string) (AuthMode, error) {
+	switch mode := AuthMode(s); mode {
+	case AuthToken, AuthCert, AuthEither, AuthBoth:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown auth mode %q", s)
+}
+
+// WithClientCerts identifies callers by their verified client certificate
+// according to mode.
+func WithClientCerts(mapper *auth.CertMapper, mode AuthMode) Option {
+	return func(s *Server) {
+		s.certs = mapper
+		s.authMode = mode
+	}
+}
+
+// authEnabled reports whether requests must authenticate. Without it every
+// caller is trusted.
+func (s *Server) authEnabled() bool {
+	return s.tokens != nil || s.certs != nil
+}
+
+// authenticate resolves the caller's identity from its bearer token and
+// client certificate as the auth mode requires, writing an error response
+// when it cannot. With both credentials the token's identity is used. In
+// either mode an unmapped certificate is ignored when a token is presented.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (auth.Identity, bool) {
+	var (
+		fromToken, fromCert *auth.Identity
+		certErr             error
+	)
+	if s.authMode != AuthCert {
+		if authz := r.Header.Get("Authorization"); strings.HasPrefix(authz, "Bearer ") {
+			if s.tokens == nil {
+				respondError(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+				return auth.Identity{}, false
+			}
+			id, err := s.tokens.Authenticate(strings.TrimSpace(strings.TrimPrefix(authz, "Bearer ")))
+			if err != nil {
+				respondError(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+				return auth.Identity{}, false
+			}
+			fromToken = &id
+		}
+	}
+	if s.authMode != AuthToken && s.certs != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if id, err := s.certs.Identify(r.TLS.VerifiedChains[0][0]); err != nil {
+			certErr = err
+		} else {
+			fromCert = &id
+		}
+	}
+	if certErr != nil && (s.authMode != AuthEither || fromToken == nil) {
+		respondError(w, http.StatusUnauthorized, "unknown_certificate", certErr.Error())
+		return auth.Identity{}, false
+	}
+
+	switch {
+	case fromToken == nil && (s.authMode == AuthToken || s.authMode == AuthBoth):
+		respondError(w, http.StatusUnauthorized, "unauthorized", "missing bearer token")
+		return auth.Identity{}, false
+	case fromCert == nil && (s.authMode == AuthCert || s.authMode == AuthBoth):
+		respondError(w, http.StatusUnauthorized, "client_certificate_required", "a verified client certificate is required")
+		return auth.Identity{}, false
+	case fromToken == nil && fromCert == nil:
+		respondError(w, http.StatusUnauthorized, "unauthorized", "bearer token or client certificate required")
+		return auth.Identity{}, false
+	case fromToken != nil && fromCert != nil && fromToken.Principal != fromCert.Principal:
+		respondError(w, http.StatusUnauthorized, "identity_mismatch",
+			fmt.Sprintf("token principal %s does not match certificate principal %s", fromToken.Principal, fromCert.Principal))
+		return auth.Identity{}, false
+	case fromToken != nil:
+		return *fromToken, true
+	}
+	return *fromCert, true
+}
+
+type requestInfoKey struct{}
+
+// requestInfo is filled in by requireAuth so logRequests can report the
+// principal once the handler returns.
+type requestInfo struct {
+	principal string
+}
+
+// logRequests logs each request with its status, duration and the principal
+// it authenticated as.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{principal: "-"}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		log.Printf("%s %s %d %s principal=%s", r.Method, r.URL.RequestURI(), status, time.Since(start).Round(time.Microsecond), info.principal)
+	})
+}
@@ -0,0 +1,105 @@
+package httpapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AtDexters-Lab/aionFS/internal/auth"
+)
+
+// whoamiAs calls whoami with an optional bearer token and a client
+// certificate carrying uri, when set, as if the TLS layer had verified it.
+func whoamiAs(t *testing.T, h http.Handler, token, uri string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/v1/auth/whoami", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if uri != "" {
+		u, err := url.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := &x509.Certificate{URIs: []*url.URL{u}, Subject: pkix.Name{CommonName: "client"}}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthModes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "certs.json")
+	if err := os.WriteFile(path, []byte(`{"spiffe://piccolo/app": "svc", "spiffe://piccolo/other": "other"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mapper, err := auth.NewCertMapper(path)
+	if err != nil {
+		t.Fatalf("NewCertMapper: %v", err)
+	}
+	tokens := tokenTable{"svc-token": {Principal: "svc", Role: auth.RoleTenant}}
+
+	const (
+		mapped   = "spiffe://piccolo/app"
+		other    = "spiffe://piccolo/other"
+		unmapped = "spiffe://elsewhere/app"
+	)
+	cases := []struct {
+		mode  AuthMode
+		token string
+		cert  string
+		want  int
+		code  string
+	}{
+		{AuthToken, "svc-token", "", http.StatusOK, ""},
+		{AuthToken, "", mapped, http.StatusUnauthorized, "unauthorized"},
+		{AuthToken, "svc-token", unmapped, http.StatusOK, ""},
+		{AuthToken, "bogus", "", http.StatusUnauthorized, "unauthorized"},
+
+		{AuthCert, "", mapped, http.StatusOK, ""},
+		{AuthCert, "svc-token", "", http.StatusUnauthorized, "client_certificate_required"},
+		{AuthCert, "", unmapped, http.StatusUnauthorized, "unknown_certificate"},
+		{AuthCert, "bogus", mapped, http.StatusOK, ""},
+
+		{AuthEither, "svc-token", "", http.StatusOK, ""},
+		{AuthEither, "", mapped, http.StatusOK, ""},
+		{AuthEither, "", "", http.StatusUnauthorized, "unauthorized"},
+		{AuthEither, "svc-token", unmapped, http.StatusOK, ""},
+		{AuthEither, "", unmapped, http.StatusUnauthorized, "unknown_certificate"},
+		{AuthEither, "svc-token", other, http.StatusUnauthorized, "identity_mismatch"},
+
+		{AuthBoth, "svc-token", mapped, http.StatusOK, ""},
+		{AuthBoth, "svc-token", "", http.StatusUnauthorized, "client_certificate_required"},
+		{AuthBoth, "", mapped, http.StatusUnauthorized, "unauthorized"},
+		{AuthBoth, "svc-token", unmapped, http.StatusUnauthorized, "unknown_certificate"},
+		{AuthBoth, "svc-token", other, http.StatusUnauthorized, "identity_mismatch"},
+	}
+	servers := map[AuthMode]http.Handler{}
+	for _, mode := range []AuthMode{AuthToken, AuthCert, AuthEither, AuthBoth} {
+		s, _ := newTestServer(t, tokens, WithClientCerts(mapper, mode))
+		servers[mode] = s.Router()
+	}
+	for _, tc := range cases {
+		name := string(tc.mode) + "/token=" + tc.token + "/cert=" + tc.cert
+		t.Run(name, func(t *testing.T) {
+			rec := whoamiAs(t, servers[tc.mode], tc.token, tc.cert)
+			expectStatus(t, rec, tc.want)
+			if tc.want != http.StatusOK {
+				if code := decodeBody[errorResponse](t, rec).Error; code != tc.code {
+					t.Fatalf("error = %q, want %q", code, tc.code)
+				}
+				return
+			}
+			if got := decodeBody[whoamiResponse](t, rec).Principal; got != "svc" {
+				t.Fatalf("principal = %q, want svc", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,501 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/ids"
+	"github.com/AtDexters-Lab/aionFS/internal/labels"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	consistencyCrash = "crash"
+
+	operationKindCheckpoint = "checkpoint.create"
+
+	defaultFreezeTimeout = 2 * time.Second
+	maxFreezeTimeout     = 5 * time.Second
+
+	defaultCapsuleLimit = 1 << 20
+	capsuleHashHeader   = "X-Content-SHA256"
+
+	// checkpointRequestAllowance is the room left for the fields of a create
+	// request beside its inline capsule.
+	checkpointRequestAllowance = 1 << 20
+)
+
+type createCheckpointRequest struct {
+	VolumeIDs []string `json:"volume_ids"`
+	// Selector picks member volumes by label instead of listing them.
+	Selector    string            `json:"selector,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Note        string            `json:"note,omitempty"`
+	// Consistency selects "crash" to capture every member under a shared
+	// write barrier instead of reusing each volume's latest snapshot.
+	Consistency     string `json:"consistency,omitempty"`
+	FreezeTimeoutMs int64  `json:"freeze_timeout_ms,omitempty"`
+	// IncludeEphemeral adds ephemeral volumes, which are otherwise left out.
+	IncludeEphemeral bool `json:"include_ephemeral,omitempty"`
+	// Capsule is an optional JSON capsule stored alongside the manifest.
+	Capsule json.RawMessage `json:"capsule,omitempty"`
+}
+
+func (s *Server) handleCreateCheckpoint(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+
+	var req createCheckpointRequest
+	body := http.MaxBytesReader(w, r.Body, s.capsuleLimit+checkpointRequestAllowance)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondCapsuleTooLarge(w, s.capsuleLimit)
+			return
+		}
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	// A null capsule is the same as leaving it out.
+	if string(bytes.TrimSpace(req.Capsule)) == "null" {
+		req.Capsule = nil
+	}
+	if len(req.VolumeIDs) > 0 && req.Selector != "" {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "volume_ids and selector are mutually exclusive")
+		return
+	}
+	sel, err := labels.Parse(req.Selector)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_selector", err.Error())
+		return
+	}
+	if !validateMetadata(w, req.Labels, req.Annotations) {
+		return
+	}
+	switch req.Consistency {
+	case "", consistencyCrash:
+	default:
+		respondError(w, http.StatusBadRequest, "invalid_consistency", fmt.Sprintf("unsupported consistency mode %q", req.Consistency))
+		return
+	}
+	if int64(len(req.Capsule)) > s.capsuleLimit {
+		respondCapsuleTooLarge(w, s.capsuleLimit)
+		return
+	}
+	freezeTimeout := defaultFreezeTimeout
+	if req.FreezeTimeoutMs < 0 {
+		respondError(w, http.StatusBadRequest, "invalid_freeze_timeout", "freeze_timeout_ms must not be negative")
+		return
+	}
+	if req.FreezeTimeoutMs > 0 {
+		freezeTimeout = time.Duration(req.FreezeTimeoutMs) * time.Millisecond
+		if freezeTimeout > maxFreezeTimeout {
+			respondError(w, http.StatusBadRequest, "invalid_freeze_timeout", fmt.Sprintf("freeze_timeout_ms must not exceed %d", maxFreezeTimeout.Milliseconds()))
+			return
+		}
+	}
+
+	volumeIDs := req.VolumeIDs
+	if len(volumeIDs) == 0 {
+		candidates := s.store.SelectVolumes(sel)
+		volumeIDs = make([]string, 0, len(candidates))
+		for _, v := range candidates {
+			// Volumes shared with the caller are only included when named.
+			if s.authEnabled() && v.OwnerPrincipal != principal {
+				continue
+			}
+			if !tokenAllows(r.Context(), v, store.VerbSnapshot) {
+				continue
+			}
+			if v.Ephemeral() && !req.IncludeEphemeral {
+				continue
+			}
+			volumeIDs = append(volumeIDs, v.VolumeID)
+		}
+		if req.Selector != "" && len(volumeIDs) == 0 {
+			respondError(w, http.StatusBadRequest, "no_matching_volumes", "selector matched no volumes")
+			return
+		}
+		sort.Strings(volumeIDs)
+	}
+	volumeIDs = dedupe(volumeIDs)
+
+	for _, vid := range volumeIDs {
+		vol, err := s.store.GetVolume(vid)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_volume", fmt.Sprintf("unknown volume %s", vid))
+			return
+		}
+		if !s.authorized(r.Context(), vol, store.VerbSnapshot) {
+			respondError(w, http.StatusForbidden, "principal_mismatch", fmt.Sprintf("principal not authorised for snapshot on volume %s", vid))
+			return
+		}
+		if vol.Ephemeral() && !req.IncludeEphemeral {
+			respondEphemeralExcluded(w, vid)
+			return
+		}
+	}
+
+	manifestID := ids.New(ids.Checkpoint)
+	build := func(ctx context.Context) (store.Checkpoint, error) {
+		return s.buildCheckpoint(ctx, manifestID, principal, volumeIDs, req, freezeTimeout)
+	}
+
+	if preferAsync(r) {
+		op, err := s.startOperation(operationKindCheckpoint, manifestID, principal, 1, nil,
+			func(ctx context.Context, t *operationTracker) (interface{}, error) {
+				cp, err := build(ctx)
+				if err != nil {
+					return nil, err
+				}
+				t.advance()
+				return cp, nil
+			})
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+			return
+		}
+		respondOperation(w, op)
+		return
+	}
+
+	persisted, err := build(r.Context())
+	if err != nil {
+		var fe *freezeError
+		if errors.As(err, &fe) {
+			respondError(w, http.StatusConflict, "freeze_failed", fe.Error())
+			return
+		}
+		if errors.Is(err, store.ErrVolumeNotFound) {
+			respondError(w, http.StatusConflict, "missing_volume", "a member volume was deleted while the checkpoint was being captured")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, persisted)
+}
+
+// buildCheckpoint gathers one snapshot per volume and persists the manifest
+// together with its optional inline capsule.
+func (s *Server) buildCheckpoint(ctx context.Context, manifestID, principal string, volumeIDs []string, req createCheckpointRequest, freezeTimeout time.Duration) (store.Checkpoint, error) {
+	var (
+		snapshotIDs []string
+		skew        time.Duration
+	)
+	if req.Consistency == consistencyCrash {
+		ids, captureSkew, err := s.captureConsistencyGroup(ctx, volumeIDs, freezeTimeout)
+		if err != nil {
+			return store.Checkpoint{}, err
+		}
+		snapshotIDs, skew = ids, captureSkew
+	} else {
+		snapshotIDs = make([]string, 0, len(volumeIDs))
+		for _, vid := range volumeIDs {
+			latest, ok := s.store.LatestSnapshot(vid)
+			if !ok {
+				created, err := s.store.AddSnapshot(vid, store.Snapshot{
+					SnapshotID: ids.New(ids.Snapshot),
+					VolumeID:   vid,
+					CreatedAt:  time.Now().UTC(),
+					Note:       "auto-generated for checkpoint",
+				})
+				if err != nil {
+					return store.Checkpoint{}, err
+				}
+				latest = created
+			}
+			snapshotIDs = append(snapshotIDs, latest.SnapshotID)
+		}
+	}
+
+	manifest := store.Checkpoint{
+		ManifestID:       manifestID,
+		SnapshotIDs:      snapshotIDs,
+		CreatedAt:        time.Now().UTC(),
+		Note:             req.Note,
+		Consistency:      req.Consistency,
+		CaptureSkewNanos: skew.Nanoseconds(),
+		OwnerPrincipal:   principal,
+		Labels:           req.Labels,
+		Annotations:      req.Annotations,
+	}
+
+	var capsule []byte
+	if len(req.Capsule) > 0 {
+		capsule = req.Capsule
+	}
+	return s.store.PutCheckpoint(manifest, "application/json", capsule)
+}
+
+// captureConsistencyGroup freezes every member, captures one snapshot per
+// volume under the shared barrier and releases the group once the records are
+// persisted. It returns the snapshot IDs in member order and how long writes
+// were held: from the barrier going up until the snapshots were persisted.
+func (s *Server) captureConsistencyGroup(ctx context.Context, volumeIDs []string, timeout time.Duration) ([]string, time.Duration, error) {
+	freezeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	thaw, frozenAt, err := s.freezer.freeze(freezeCtx, volumeIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer thaw()
+
+	snaps := make([]store.Snapshot, 0, len(volumeIDs))
+	for _, vid := range volumeIDs {
+		snaps = append(snaps, store.Snapshot{
+			SnapshotID: ids.New(ids.Snapshot),
+			VolumeID:   vid,
+			CreatedAt:  time.Now().UTC(),
+			Note:       "captured for consistency group",
+		})
+	}
+	if _, err := s.store.AddSnapshots(snaps); err != nil {
+		return nil, 0, err
+	}
+	window := time.Since(frozenAt)
+
+	snapshotIDs := make([]string, 0, len(snaps))
+	for _, snap := range snaps {
+		snapshotIDs = append(snapshotIDs, snap.SnapshotID)
+	}
+	return snapshotIDs, window, nil
+}
+
+func dedupe(ids []string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		out = append(out, id)
+	}
+	return out
+}
+
+func (s *Server) handleListCheckpoints(w http.ResponseWriter, r *http.Request) {
+	_, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+
+	sel, ok := requestSelector(w, r)
+	if !ok {
+		return
+	}
+
+	pg, ok := requestPage(w, r)
+	if !ok {
+		return
+	}
+
+	owner := r.URL.Query().Get("owner")
+	manifests := make([]store.Checkpoint, 0)
+	for _, cp := range s.store.ListCheckpoints() {
+		if s.authEnabled() && !s.checkpointVisible(r.Context(), cp) {
+			continue
+		}
+		if owner != "" && cp.OwnerPrincipal != owner {
+			continue
+		}
+		if !sel.Matches(cp.Labels) || !pg.admits(cp.ManifestID) {
+			continue
+		}
+		manifests = append(manifests, cp)
+		if pg.full(len(manifests)) {
+			break
+		}
+	}
+
+	respondJSON(w, http.StatusOK, manifests)
+}
+
+func (s *Server) handleGetCheckpoint(w http.ResponseWriter, r *http.Request) {
+	cp, ok := s.loadCheckpoint(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, cp)
+}
+
+func (s *Server) handlePutCapsule(w http.ResponseWriter, r *http.Request) {
+	cp, ok := s.loadCheckpoint(w, r)
+	if !ok {
+		return
+	}
+	// Replacing the capsule rewrites part of the capture, so it takes the
+	// same permission as taking it.
+	if vid, ok := s.checkpointVolumesAllow(r.Context(), cp, store.VerbSnapshot); !ok {
+		respondError(w, http.StatusForbidden, "principal_mismatch", fmt.Sprintf("principal not authorised for snapshot on volume %s", vid))
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, s.capsuleLimit+1))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to read capsule body")
+		return
+	}
+	if int64(len(data)) > s.capsuleLimit {
+		respondCapsuleTooLarge(w, s.capsuleLimit)
+		return
+	}
+	if len(data) == 0 {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "capsule body is empty")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if isJSONMediaType(contentType) && !json.Valid(data) {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "capsule declared as JSON but does not parse")
+		return
+	}
+	if want := r.Header.Get(capsuleHashHeader); want != "" {
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(want, hex.EncodeToString(sum[:])) {
+			respondError(w, http.StatusBadRequest, "digest_mismatch", "capsule content does not match "+capsuleHashHeader)
+			return
+		}
+	}
+
+	persisted, err := s.store.PutCapsule(cp.ManifestID, contentType, data)
+	if err != nil {
+		if errors.Is(err, store.ErrCheckpointNotFound) {
+			respondError(w, http.StatusNotFound, "not_found", "checkpoint not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, persisted)
+}
+
+func (s *Server) handleGetCapsule(w http.ResponseWriter, r *http.Request) {
+	cp, ok := s.loadCheckpoint(w, r)
+	if !ok {
+		return
+	}
+	info, data, err := s.store.ReadCapsule(cp.ManifestID)
+	if err != nil {
+		if errors.Is(err, store.ErrCapsuleNotFound) || errors.Is(err, store.ErrCheckpointNotFound) {
+			respondError(w, http.StatusNotFound, "not_found", "checkpoint has no capsule")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set(capsuleHashHeader, info.SHA256)
+	w.Header().Set("ETag", `"sha256:`+info.SHA256+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// loadCheckpoint resolves the {checkpointID} URL parameter and enforces that
+// the caller may see the manifest, writing an error response otherwise.
+func (s *Server) loadCheckpoint(w http.ResponseWriter, r *http.Request) (store.Checkpoint, bool) {
+	_, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return store.Checkpoint{}, false
+	}
+	cp, err := s.store.GetCheckpoint(chi.URLParam(r, "checkpointID"))
+	if err != nil {
+		if errors.Is(err, store.ErrCheckpointNotFound) {
+			respondError(w, http.StatusNotFound, "not_found", "checkpoint not found")
+			return store.Checkpoint{}, false
+		}
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return store.Checkpoint{}, false
+	}
+	if s.authEnabled() && !s.checkpointVisible(r.Context(), cp) {
+		respondError(w, http.StatusForbidden, "principal_mismatch", "principal not authorised for this checkpoint")
+		return store.Checkpoint{}, false
+	}
+	return cp, true
+}
+
+// checkpointVisible reports whether the caller may see a manifest. Manifests
+// that predate owner tracking are visible when the caller may read every
+// referenced volume.
+func (s *Server) checkpointVisible(ctx context.Context, cp store.Checkpoint) bool {
+	if s.seesAll(ctx) {
+		return true
+	}
+	if cp.OwnerPrincipal != "" {
+		principal, _ := principalFromContext(ctx)
+		return cp.OwnerPrincipal == principal
+	}
+	for _, sid := range cp.SnapshotIDs {
+		vid, ok := s.store.VolumeIDForSnapshot(sid)
+		if !ok {
+			continue
+		}
+		vol, err := s.store.GetVolume(vid)
+		if err != nil || !s.authorized(ctx, vol, store.VerbRead) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkpointVolumesAllow reports whether the caller may perform verb on
+// every volume a manifest captured, and otherwise the first volume it may
+// not. Volumes deleted since the capture are skipped.
+func (s *Server) checkpointVolumesAllow(ctx context.Context, cp store.Checkpoint, verb string) (string, bool) {
+	for _, sid := range cp.SnapshotIDs {
+		vid, ok := s.store.VolumeIDForSnapshot(sid)
+		if !ok {
+			continue
+		}
+		vol, err := s.store.GetVolume(vid)
+		if err != nil {
+			continue
+		}
+		if !s.authorized(ctx, vol, verb) {
+			return vid, false
+		}
+	}
+	return "", true
+}
+
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func respondEphemeralExcluded(w http.ResponseWriter, volumeID string) {
+	respondError(w, http.StatusConflict, "ephemeral_volume", fmt.Sprintf("volume %s is ephemeral; set include_ephemeral to capture it", volumeID))
+}
+
+func respondCapsuleTooLarge(w http.ResponseWriter, limit int64) {
+	respondError(w, http.StatusRequestEntityTooLarge, "capsule_too_large", fmt.Sprintf("capsule exceeds %d bytes", limit))
+}
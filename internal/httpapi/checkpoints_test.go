@@ -0,0 +1,159 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/auth"
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+// TestPutCapsuleRequiresSnapshot checks that seeing a checkpoint is not
+// enough to replace its capsule.
+func TestPutCapsuleRequiresSnapshot(t *testing.T) {
+	tokens := tokenTable{
+		"owner":     {Principal: "svc", Role: auth.RoleTenant},
+		"read-only": {Principal: "svc", Role: auth.RoleTenant, Scopes: []string{store.VerbRead}},
+	}
+	s, _ := newTestServer(t, tokens)
+	h := s.Router()
+	vol := createVolume(t, h, "svc", bearer("owner")...)
+
+	rec := request(t, h, http.MethodPost, "/v1/checkpoints", createCheckpointRequest{
+		VolumeIDs: []string{vol.VolumeID},
+		Capsule:   []byte(`{"step":1}`),
+	}, bearer("owner")...)
+	expectStatus(t, rec, http.StatusCreated)
+	cp := decodeBody[store.Checkpoint](t, rec)
+	if cp.Capsule == nil {
+		t.Fatalf("inline capsule not recorded on %+v", cp)
+	}
+
+	path := "/v1/checkpoints/" + cp.ManifestID + "/capsule"
+	rec = request(t, h, http.MethodGet, "/v1/checkpoints/"+cp.ManifestID, nil, bearer("read-only")...)
+	expectStatus(t, rec, http.StatusOK)
+	rec = request(t, h, http.MethodPut, path, `{"step":2}`, append(bearer("read-only"), "Content-Type", "application/json")...)
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = request(t, h, http.MethodPut, path, `{"step":2}`, append(bearer("owner"), "Content-Type", "application/json")...)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+// TestPatchCheckpointRequiresSnapshot checks that seeing a checkpoint is not
+// enough to relabel it.
+func TestPatchCheckpointRequiresSnapshot(t *testing.T) {
+	tokens := tokenTable{
+		"owner":     {Principal: "svc", Role: auth.RoleTenant},
+		"read-only": {Principal: "svc", Role: auth.RoleTenant, Scopes: []string{store.VerbRead}},
+	}
+	s, _ := newTestServer(t, tokens)
+	h := s.Router()
+	vol := createVolume(t, h, "svc", bearer("owner")...)
+
+	rec := request(t, h, http.MethodPost, "/v1/checkpoints", createCheckpointRequest{
+		VolumeIDs: []string{vol.VolumeID},
+	}, bearer("owner")...)
+	expectStatus(t, rec, http.StatusCreated)
+	cp := decodeBody[store.Checkpoint](t, rec)
+
+	path := "/v1/checkpoints/" + cp.ManifestID
+	patch := map[string]interface{}{"labels": map[string]string{"keep": "true"}}
+	rec = request(t, h, http.MethodPatch, path, patch, bearer("read-only")...)
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = request(t, h, http.MethodPatch, path, patch, bearer("owner")...)
+	expectStatus(t, rec, http.StatusOK)
+	if got := decodeBody[store.Checkpoint](t, rec).Labels["keep"]; got != "true" {
+		t.Fatalf("label keep = %q, want true", got)
+	}
+}
+
+func TestCreateCheckpointCapsuleBounds(t *testing.T) {
+	s, _ := newTestServer(t, nil, WithCapsuleLimit(64))
+	h := s.Router()
+	vol := createVolume(t, h, "svc")
+
+	rec := request(t, h, http.MethodPost, "/v1/checkpoints",
+		`{"volume_ids":["`+vol.VolumeID+`"],"capsule":null}`)
+	expectStatus(t, rec, http.StatusCreated)
+	if cp := decodeBody[store.Checkpoint](t, rec); cp.Capsule != nil {
+		t.Fatalf("null capsule stored: %+v", cp.Capsule)
+	}
+
+	cases := []struct {
+		name    string
+		capsule string
+	}{
+		{"over the capsule limit", `"` + strings.Repeat("x", 100) + `"`},
+		{"over the body limit", `"` + strings.Repeat("x", checkpointRequestAllowance+100) + `"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := request(t, h, http.MethodPost, "/v1/checkpoints",
+				`{"volume_ids":["`+vol.VolumeID+`"],"capsule":`+tc.capsule+`}`)
+			expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+		})
+	}
+}
+
+// holdDuringFreeze keeps a write in flight on volumeID while a crash-consistent
+// checkpoint of it freezes, runs during once the barrier is up and then lets
+// the capture proceed. It returns the checkpoint response.
+func holdDuringFreeze(t *testing.T, s *Server, volumeID string, during func()) *httptest.ResponseRecorder {
+	t.Helper()
+	release, ok := s.freezer.beginWrite(volumeID)
+	if !ok {
+		t.Fatalf("volume %s is already frozen", volumeID)
+	}
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- request(t, s.Router(), http.MethodPost, "/v1/checkpoints", createCheckpointRequest{
+			VolumeIDs:   []string{volumeID},
+			Consistency: consistencyCrash,
+		})
+	}()
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		probe, ok := s.freezer.beginWrite(volumeID)
+		if !ok {
+			break
+		}
+		probe()
+		if time.Now().After(deadline) {
+			release()
+			t.Fatalf("checkpoint never froze %s", volumeID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	during()
+	release()
+	return <-done
+}
+
+func TestCrashCheckpointCapture(t *testing.T) {
+	s, st := newTestServer(t, nil)
+	h := s.Router()
+
+	vol := createVolume(t, h, "svc")
+	const hold = 20 * time.Millisecond
+	rec := holdDuringFreeze(t, s, vol.VolumeID, func() { time.Sleep(hold) })
+	expectStatus(t, rec, http.StatusCreated)
+	if skew := time.Duration(decodeBody[store.Checkpoint](t, rec).CaptureSkewNanos); skew < hold {
+		t.Fatalf("capture skew = %v, want at least the %v writes were held", skew, hold)
+	}
+
+	vol = createVolume(t, h, "svc")
+	rec = holdDuringFreeze(t, s, vol.VolumeID, func() {
+		if _, err := st.TransitionVolume(vol.VolumeID, lifecycle.Deleting, "test", "svc", nil); err != nil {
+			t.Errorf("mark volume deleting: %v", err)
+		}
+		if err := st.DeleteVolume(vol.VolumeID); err != nil {
+			t.Errorf("delete volume: %v", err)
+		}
+	})
+	expectStatus(t, rec, http.StatusConflict)
+	if code := decodeBody[errorResponse](t, rec).Error; code != "missing_volume" {
+		t.Fatalf("error = %q, want missing_volume", code)
+	}
+}
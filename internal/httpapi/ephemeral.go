@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+	"github.com/AtDexters-Lab/aionFS/internal/notify"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+const (
+	defaultEphemeralTTL = 24 * time.Hour
+
+	// ephemeralPrincipal is recorded on transitions made when an ephemeral
+	// volume's TTL lapses.
+	ephemeralPrincipal = "system:ephemeral-reaper"
+)
+
+// ephemeralExpiry returns when a volume of class created now should be
+// wiped. ttl overrides the server default; persistent volumes never expire.
+func (s *Server) ephemeralExpiry(class string, ttl time.Duration) *time.Time {
+	if class != store.ClassEphemeral {
+		return nil
+	}
+	if ttl <= 0 {
+		ttl = s.ephemeralTTL
+	}
+	at := s.now().Add(ttl)
+	return &at
+}
+
+// discardEphemeral wipes and deletes an ephemeral volume once its last
+// session has gone. Other volumes are returned unchanged. The caller holds
+// the volume's write gate.
+func (s *Server) discardEphemeral(v store.Volume, principal string) (store.Volume, error) {
+	if !v.Ephemeral() || v.AttachState != lifecycle.Available {
+		return v, nil
+	}
+	wiped, err := s.store.TransitionVolume(v.VolumeID, lifecycle.Deleting, "ephemeral volume wiped on detach", principal, nil)
+	if err != nil {
+		return store.Volume{}, err
+	}
+	if err := s.store.DeleteVolume(v.VolumeID); err != nil {
+		return store.Volume{}, err
+	}
+	return wiped, nil
+}
+
+// reapEphemeralVolumes wipes every ephemeral volume whose TTL has lapsed,
+// tearing down any sessions still holding it, and returns how many were
+// removed. Frozen volumes are left for a later pass.
+func (s *Server) reapEphemeralVolumes() int {
+	reaped := 0
+	now := s.now()
+	for _, vol := range s.store.ListVolumes() {
+		if !vol.Ephemeral() || vol.ExpiresAt == nil || now.Before(*vol.ExpiresAt) {
+			continue
+		}
+		if s.reapEphemeralVolume(vol.VolumeID) {
+			reaped++
+		}
+	}
+	return reaped
+}
+
+func (s *Server) reapEphemeralVolume(volumeID string) bool {
+	release, ok := s.freezer.beginWrite(volumeID)
+	if !ok {
+		return false
+	}
+	defer release()
+
+	const reason = "ephemeral volume expired"
+	vol, err := s.store.GetVolume(volumeID)
+	if err != nil {
+		return false
+	}
+	if vol.AttachState == lifecycle.Attached {
+		if _, err := s.teardownSessions(volumeID, notify.EventSessionRevoked, reason, ephemeralPrincipal, func(v store.Volume) ([]store.Session, error) {
+			return v.AttachSessions, nil
+		}); err != nil {
+			log.Printf("ephemeral reaper: volume %s: %v", volumeID, err)
+			return false
+		}
+	}
+	if err := s.deleteVolume(volumeID, reason, ephemeralPrincipal); err != nil {
+		// Volumes still preparing or already deleting are left alone.
+		if !errors.Is(err, lifecycle.ErrIllegalTransition) && !errors.Is(err, store.ErrVolumeNotFound) {
+			log.Printf("ephemeral reaper: volume %s: %v", volumeID, err)
+		}
+		return false
+	}
+	log.Printf("ephemeral reaper: wiped expired volume %s", volumeID)
+	return true
+}
@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestStaleHolderIsFenced pauses the first holder until its lease lapses and
+// the session is attached again elsewhere. The old holder's generation must
+// be refused everywhere it is checked.
+func TestStaleHolderIsFenced(t *testing.T) {
+	clock := newFakeClock()
+	s, _ := newTestServer(t, nil, WithClock(clock.Now), WithLeaseTTL(time.Minute))
+	h := s.Router()
+	vol := createVolume(t, h, "svc")
+	old := attach(t, h, vol.VolumeID, "svc", "s1")
+
+	clock.Advance(2 * time.Minute)
+	s.reapExpiredSessions()
+	current := attach(t, h, vol.VolumeID, "svc", "s1")
+	if current.Generation <= old.Generation {
+		t.Fatalf("generation did not advance: old %d, new %d", old.Generation, current.Generation)
+	}
+
+	stale := strconv.FormatUint(old.Generation, 10)
+	base := "/v1/volumes/" + vol.VolumeID
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"heartbeat", http.MethodPost, base + "/sessions/s1/heartbeat", nil},
+		{"detach", http.MethodPost, base + "/detach", detachRequest{SessionID: "s1"}},
+		{"snapshot", http.MethodPost, base + "/snapshots", map[string]string{"note": "from the old holder"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := request(t, h, tc.method, tc.path, tc.body, fencingHeader, stale)
+			expectStatus(t, rec, http.StatusConflict)
+			if got := decodeBody[map[string]string](t, rec)["error"]; got != "stale_generation" {
+				t.Fatalf("error = %q, want stale_generation", got)
+			}
+		})
+	}
+
+	// The current holder is unaffected.
+	expectStatus(t, heartbeat(t, h, vol.VolumeID, "s1", current.Generation), http.StatusOK)
+	rec := request(t, h, http.MethodPost, base+"/snapshots", nil, fencingHeader, strconv.FormatUint(current.Generation, 10))
+	expectStatus(t, rec, http.StatusCreated)
+}
+
+func TestFencingRequiresGeneration(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	h := s.Router()
+	vol := createVolume(t, h, "svc")
+	attach(t, h, vol.VolumeID, "svc", "s1")
+
+	rec := request(t, h, http.MethodPost, "/v1/volumes/"+vol.VolumeID+"/sessions/s1/heartbeat", nil)
+	expectStatus(t, rec, http.StatusPreconditionRequired)
+}
+
+// TestSnapshotRequiresLiveGeneration checks that a writer cannot avoid
+// fencing by leaving the generation out of a snapshot request.
+func TestSnapshotRequiresLiveGeneration(t *testing.T) {
+	clock := newFakeClock()
+	s, _ := newTestServer(t, nil, WithClock(clock.Now), WithLeaseTTL(time.Minute))
+	h := s.Router()
+	vol := createVolume(t, h, "svc")
+	path := "/v1/volumes/" + vol.VolumeID + "/snapshots"
+
+	expectStatus(t, request(t, h, http.MethodPost, path, nil), http.StatusCreated)
+
+	session := attach(t, h, vol.VolumeID, "svc", "s1")
+	generation := strconv.FormatUint(session.Generation, 10)
+	expectStatus(t, request(t, h, http.MethodPost, path, nil), http.StatusPreconditionRequired)
+	expectStatus(t, request(t, h, http.MethodPost, path, nil, fencingHeader, generation), http.StatusCreated)
+
+	// A lapsed lease no longer vouches for its holder, even before reaping.
+	clock.Advance(2 * time.Minute)
+	rec := request(t, h, http.MethodPost, path, nil, fencingHeader, generation)
+	expectStatus(t, rec, http.StatusConflict)
+	if got := decodeBody[errorResponse](t, rec).Error; got != "stale_generation" {
+		t.Fatalf("error = %q, want stale_generation", got)
+	}
+
+	s.reapExpiredSessions()
+	expectStatus(t, request(t, h, http.MethodPost, path, nil), http.StatusCreated)
+}
@@ -0,0 +1,125 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// freezer gates volume mutations so a consistency group can hold a write
+// barrier across several volumes while their snapshots are captured.
+type freezer struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	gates map[string]*volumeGate
+}
+
+type volumeGate struct {
+	writers int
+	frozen  bool
+}
+
+// freezeError reports the member that prevented a group freeze.
+type freezeError struct {
+	VolumeID string
+	Reason   string
+}
+
+func (e *freezeError) Error() string {
+	return fmt.Sprintf("volume %s could not be frozen: %s", e.VolumeID, e.Reason)
+}
+
+func newFreezer() *freezer {
+	f := &freezer{gates: map[string]*volumeGate{}}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *freezer) gateLocked(volumeID string) *volumeGate {
+	g, ok := f.gates[volumeID]
+	if !ok {
+		g = &volumeGate{}
+		f.gates[volumeID] = g
+	}
+	return g
+}
+
+// beginWrite registers an in-flight mutation. It fails when the volume is
+// frozen; callers must invoke the returned release func once done.
+func (f *freezer) beginWrite(volumeID string) (func(), bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	g := f.gateLocked(volumeID)
+	if g.frozen {
+		return nil, false
+	}
+	g.writers++
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		g.writers--
+		if g.writers == 0 && !g.frozen {
+			delete(f.gates, volumeID)
+		}
+		f.cond.Broadcast()
+	}, true
+}
+
+// freeze blocks new writes on every member and waits for in-flight writes to
+// drain. It also returns when the barrier went up. If the context expires
+// first, all members are released again.
+func (f *freezer) freeze(ctx context.Context, volumeIDs []string) (func(), time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	frozenAt := time.Now()
+
+	frozen := make([]*volumeGate, 0, len(volumeIDs))
+	rollback := func() {
+		for _, g := range frozen {
+			g.frozen = false
+		}
+		f.pruneLocked()
+		f.cond.Broadcast()
+	}
+	for _, id := range volumeIDs {
+		g := f.gateLocked(id)
+		if g.frozen {
+			rollback()
+			return nil, time.Time{}, &freezeError{VolumeID: id, Reason: "already frozen by another consistency group"}
+		}
+		g.frozen = true
+		frozen = append(frozen, g)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.cond.Broadcast()
+	})
+	defer stop()
+
+	for i, g := range frozen {
+		for g.writers > 0 {
+			if ctx.Err() != nil {
+				rollback()
+				return nil, time.Time{}, &freezeError{VolumeID: volumeIDs[i], Reason: "in-flight writes did not drain before the deadline"}
+			}
+			f.cond.Wait()
+		}
+	}
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		rollback()
+	}, frozenAt, nil
+}
+
+func (f *freezer) pruneLocked() {
+	for id, g := range f.gates {
+		if g.writers == 0 && !g.frozen {
+			delete(f.gates, id)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/auth"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+// fakeClock is a settable clock for WithClock.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// tokenTable authenticates bearer tokens from a fixed map.
+type tokenTable map[string]auth.Identity
+
+func (t tokenTable) Authenticate(token string) (auth.Identity, error) {
+	id, ok := t[token]
+	if !ok {
+		return auth.Identity{}, auth.ErrUnknownToken
+	}
+	return id, nil
+}
+
+// bearer returns the header pair request expects for token.
+func bearer(token string) []string {
+	return []string{"Authorization", "Bearer " + token}
+}
+
+// newTestServer returns a server backed by a temporary store. It is closed
+// when the test ends, unless the test failed and may have left it wedged.
+func newTestServer(t *testing.T, tokens auth.TokenProvider, opts ...Option) (*Server, *store.FileStore) {
+	t.Helper()
+	st, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	s := NewServer(st, tokens, opts...)
+	t.Cleanup(func() {
+		if !t.Failed() {
+			s.Close()
+		}
+	})
+	return s, st
+}
+
+// request sends body, JSON encoded unless it is a string, with alternating
+// header names and values, and fails the test if the handler does not
+// return within a few seconds.
+func request(t *testing.T, h http.Handler, method, path string, body interface{}, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	switch b := body.(type) {
+	case nil:
+	case string:
+		buf.WriteString(b)
+	default:
+		if err := json.NewEncoder(&buf).Encode(b); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(rec, req)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s %s did not return", method, path)
+	}
+	return rec
+}
+
+// expectStatus fails the test unless rec has the wanted status.
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, want, rec.Body.String())
+	}
+}
+
+func decodeBody[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+// createVolume creates a volume owned by owner and returns it.
+func createVolume(t *testing.T, h http.Handler, owner string, header ...string) store.Volume {
+	t.Helper()
+	rec := request(t, h, http.MethodPost, "/v1/volumes", map[string]interface{}{
+		"owner_principal": owner,
+		"quota_bytes":     1 << 20,
+	}, header...)
+	expectStatus(t, rec, http.StatusCreated)
+	return decodeBody[store.Volume](t, rec)
+}
+
+// attach attaches sessionID for principal and returns the session.
+func attach(t *testing.T, h http.Handler, volumeID, principal, sessionID string, header ...string) store.Session {
+	t.Helper()
+	rec := request(t, h, http.MethodPost, "/v1/volumes/"+volumeID+"/attach", attachRequest{
+		Principal: principal,
+		SessionID: sessionID,
+	}, header...)
+	expectStatus(t, rec, http.StatusOK)
+	vol := decodeBody[store.Volume](t, rec)
+	session, ok := vol.Session(sessionID)
+	if !ok {
+		t.Fatalf("session %s missing from %+v", sessionID, vol.AttachSessions)
+	}
+	return session
+}
+
+func heartbeat(t *testing.T, h http.Handler, volumeID, sessionID string, generation uint64) *httptest.ResponseRecorder {
+	t.Helper()
+	return request(t, h, http.MethodPost, "/v1/volumes/"+volumeID+"/sessions/"+sessionID+"/heartbeat", nil,
+		fencingHeader, strconv.FormatUint(generation, 10))
+}
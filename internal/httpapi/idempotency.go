@@ -0,0 +1,182 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	replayedHeader    = "Idempotent-Replayed"
+
+	defaultIdempotencyTTL = 24 * time.Hour
+	maxIdempotencyKey     = 255
+)
+
+// inflightKeys tracks idempotency keys whose first request is still being
+// handled.
+type inflightKeys struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+func newInflightKeys() *inflightKeys {
+	return &inflightKeys{keys: map[string]struct{}{}}
+}
+
+func (k *inflightKeys) acquire(key string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, busy := k.keys[key]; busy {
+		return false
+	}
+	k.keys[key] = struct{}{}
+	return true
+}
+
+func (k *inflightKeys) release(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, key)
+}
+
+// recordingWriter captures the response so it can be stored for replay.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(p)
+	return rw.ResponseWriter.Write(p)
+}
+
+// maxKeyedBody bounds the bodies idempotency buffers to hash. It is the
+// largest body any POST accepts, an archive import.
+func (s *Server) maxKeyedBody() int64 {
+	return s.capsuleLimit + archiveMetadataAllowance
+}
+
+// idempotency replays the stored response of a POST retried with the same
+// Idempotency-Key. Reusing a key for a different request returns 422, and a
+// retry that races the original returns 409. Responses with a 5xx status are
+// not stored so the retry runs again.
+func (s *Server) idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			respondError(w, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be at most 255 characters")
+			return
+		}
+		principal, _ := principalFromContext(r.Context())
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxKeyedBody()))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respondError(w, http.StatusRequestEntityTooLarge, "payload_too_large", fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+				return
+			}
+			respondError(w, http.StatusBadRequest, "invalid_payload", "unable to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.New()
+		io.WriteString(sum, r.Method+" "+r.URL.RequestURI()+"\n")
+		sum.Write(body)
+		hash := hex.EncodeToString(sum.Sum(nil))
+
+		if s.replayStored(w, principal, key, hash) {
+			return
+		}
+
+		inflight := principal + "\x00" + key
+		if !s.inflight.acquire(inflight) {
+			respondError(w, http.StatusConflict, "request_in_progress", "a request with this Idempotency-Key is still being processed")
+			return
+		}
+		defer s.inflight.release(inflight)
+		// The first request may have finished between the check above and
+		// acquiring the key.
+		if s.replayStored(w, principal, key, hash) {
+			return
+		}
+
+		rw := &recordingWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		if rw.status == 0 || rw.status >= http.StatusInternalServerError {
+			return
+		}
+		if err := s.store.PutIdempotency(store.IdempotencyRecord{
+			Principal:   principal,
+			Key:         key,
+			RequestHash: hash,
+			Status:      rw.status,
+			ContentType: w.Header().Get("Content-Type"),
+			Location:    w.Header().Get("Location"),
+			Body:        rw.body.Bytes(),
+			CreatedAt:   s.now(),
+		}); err != nil {
+			log.Printf("idempotency: storing response for key %q: %v", key, err)
+		}
+	})
+}
+
+// replayStored answers from a live record for the key, if there is one, and
+// reports whether it wrote the response.
+func (s *Server) replayStored(w http.ResponseWriter, principal, key, hash string) bool {
+	rec, ok := s.store.GetIdempotency(principal, key)
+	if !ok || s.now().Sub(rec.CreatedAt) >= s.idempotencyTTL {
+		return false
+	}
+	if rec.RequestHash != hash {
+		respondError(w, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used for a different request")
+		return true
+	}
+	replayIdempotent(w, rec)
+	return true
+}
+
+func replayIdempotent(w http.ResponseWriter, rec store.IdempotencyRecord) {
+	if rec.ContentType != "" {
+		w.Header().Set("Content-Type", rec.ContentType)
+	}
+	if rec.Location != "" {
+		w.Header().Set("Location", rec.Location)
+	}
+	w.Header().Set(replayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	_, _ = w.Write(rec.Body)
+}
+
+// pruneIdempotency drops stored responses older than the retention window.
+func (s *Server) pruneIdempotency() {
+	if _, err := s.store.PruneIdempotency(s.now().Add(-s.idempotencyTTL)); err != nil {
+		log.Printf("idempotency: pruning records: %v", err)
+	}
+}
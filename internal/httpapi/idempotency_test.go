@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+func TestIdempotentCreateReplays(t *testing.T) {
+	clock := newFakeClock()
+	s, st := newTestServer(t, nil, WithClock(clock.Now), WithIdempotencyTTL(time.Hour))
+	h := s.Router()
+	body := map[string]interface{}{"owner_principal": "svc", "quota_bytes": 1 << 20}
+
+	first := request(t, h, http.MethodPost, "/v1/volumes", body, idempotencyHeader, "k1")
+	expectStatus(t, first, http.StatusCreated)
+	retry := request(t, h, http.MethodPost, "/v1/volumes", body, idempotencyHeader, "k1")
+	expectStatus(t, retry, http.StatusCreated)
+	if retry.Header().Get(replayedHeader) != "true" {
+		t.Fatal("retry was not replayed")
+	}
+	if a, b := decodeBody[store.Volume](t, first), decodeBody[store.Volume](t, retry); a.VolumeID != b.VolumeID {
+		t.Fatalf("retry created %s, first created %s", b.VolumeID, a.VolumeID)
+	}
+	if n := len(st.ListVolumes()); n != 1 {
+		t.Fatalf("%d volumes, want 1", n)
+	}
+
+	other := map[string]interface{}{"owner_principal": "svc", "quota_bytes": 2 << 20}
+	expectStatus(t, request(t, h, http.MethodPost, "/v1/volumes", other, idempotencyHeader, "k1"), http.StatusUnprocessableEntity)
+
+	// Records expire by the server clock.
+	clock.Advance(2 * time.Hour)
+	expired := request(t, h, http.MethodPost, "/v1/volumes", body, idempotencyHeader, "k1")
+	expectStatus(t, expired, http.StatusCreated)
+	if expired.Header().Get(replayedHeader) != "" {
+		t.Fatal("expired record was replayed")
+	}
+	if n := len(st.ListVolumes()); n != 2 {
+		t.Fatalf("%d volumes, want 2", n)
+	}
+}
+
+func TestIdempotencyBoundsBufferedBody(t *testing.T) {
+	s, _ := newTestServer(t, nil, WithCapsuleLimit(1))
+	h := s.Router()
+
+	body := strings.Repeat("x", int(s.maxKeyedBody())+1)
+	rec := request(t, h, http.MethodPost, "/v1/checkpoints:import", body, idempotencyHeader, "big")
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+	if code := decodeBody[errorResponse](t, rec).Error; code != "payload_too_large" {
+		t.Fatalf("error = %q, want payload_too_large", code)
+	}
+}
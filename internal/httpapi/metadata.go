@@ -0,0 +1,129 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/AtDexters-Lab/aionFS/internal/labels"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// metadataPatchRequest updates labels and annotations with JSON merge-patch
+// semantics: a string sets the key and null removes it.
+type metadataPatchRequest struct {
+	Labels      labels.Patch `json:"labels,omitempty"`
+	Annotations labels.Patch `json:"annotations,omitempty"`
+}
+
+// requestSelector parses the ?selector= query parameter, writing an error
+// response when it does not parse.
+func requestSelector(w http.ResponseWriter, r *http.Request) (labels.Selector, bool) {
+	sel, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_selector", err.Error())
+		return nil, false
+	}
+	return sel, true
+}
+
+// validateMetadata writes an error response when labels or annotations in a
+// create request are invalid.
+func validateMetadata(w http.ResponseWriter, labelSet, annotations map[string]string) bool {
+	if err := store.ValidateMetadata(labelSet, annotations); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_labels", err.Error())
+		return false
+	}
+	return true
+}
+
+func decodeMetadataPatch(w http.ResponseWriter, r *http.Request) (metadataPatchRequest, bool) {
+	var req metadataPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return req, false
+	}
+	return req, true
+}
+
+func (s *Server) handlePatchVolume(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	req, ok := decodeMetadataPatch(w, r)
+	if !ok {
+		return
+	}
+	if _, _, ok := s.authorizeVolume(w, r, id, store.VerbManage); !ok {
+		return
+	}
+	persisted, err := s.store.PatchVolumeMetadata(id, req.Labels, req.Annotations)
+	if errors.Is(err, labels.ErrInvalid) {
+		respondError(w, http.StatusBadRequest, "invalid_labels", err.Error())
+		return
+	}
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, persisted)
+}
+
+func (s *Server) handlePatchSnapshot(w http.ResponseWriter, r *http.Request) {
+	volumeID := chi.URLParam(r, "volumeID")
+	snapshotID := chi.URLParam(r, "snapshotID")
+	req, ok := decodeMetadataPatch(w, r)
+	if !ok {
+		return
+	}
+	if _, _, ok := s.authorizeVolume(w, r, volumeID, store.VerbSnapshot); !ok {
+		return
+	}
+	if owner, found := s.store.VolumeIDForSnapshot(snapshotID); !found || owner != volumeID {
+		respondError(w, http.StatusNotFound, "not_found", "snapshot not found")
+		return
+	}
+	persisted, err := s.store.PatchSnapshotMetadata(snapshotID, req.Labels, req.Annotations)
+	switch {
+	case errors.Is(err, labels.ErrInvalid):
+		respondError(w, http.StatusBadRequest, "invalid_labels", err.Error())
+		return
+	case errors.Is(err, store.ErrSnapshotNotFound):
+		respondError(w, http.StatusNotFound, "not_found", "snapshot not found")
+		return
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, persisted)
+}
+
+func (s *Server) handlePatchCheckpoint(w http.ResponseWriter, r *http.Request) {
+	cp, ok := s.loadCheckpoint(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeMetadataPatch(w, r)
+	if !ok {
+		return
+	}
+	// Relabelling a checkpoint can change which selectors pick it up, so it
+	// takes the same permission as patching its snapshots.
+	if vid, ok := s.checkpointVolumesAllow(r.Context(), cp, store.VerbSnapshot); !ok {
+		respondError(w, http.StatusForbidden, "principal_mismatch", fmt.Sprintf("principal not authorised for snapshot on volume %s", vid))
+		return
+	}
+	persisted, err := s.store.PatchCheckpointMetadata(cp.ManifestID, req.Labels, req.Annotations)
+	switch {
+	case errors.Is(err, labels.ErrInvalid):
+		respondError(w, http.StatusBadRequest, "invalid_labels", err.Error())
+		return
+	case errors.Is(err, store.ErrCheckpointNotFound):
+		respondError(w, http.StatusNotFound, "not_found", "checkpoint not found")
+		return
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, persisted)
+}
@@ -0,0 +1,271 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/ids"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	errOperationCancelled = errors.New("operation cancelled")
+	errServerShutdown     = errors.New("server shutting down")
+)
+
+// operationFunc performs the work of an operation. It should check ctx
+// between steps and report progress through the tracker. A non-nil result
+// replaces the operation's initial result on success.
+type operationFunc func(ctx context.Context, t *operationTracker) (interface{}, error)
+
+// operationRunner owns the cancel funcs of in-flight operation workers.
+type operationRunner struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelCauseFunc
+	wg      sync.WaitGroup
+}
+
+func newOperationRunner() *operationRunner {
+	return &operationRunner{cancels: map[string]context.CancelCauseFunc{}}
+}
+
+// operationTracker lets a worker record progress on its operation.
+type operationTracker struct {
+	s  *Server
+	mu sync.Mutex
+	op store.Operation
+}
+
+// advance marks one more step as completed.
+func (t *operationTracker) advance() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.op.Progress.Completed++
+	t.op = t.s.saveOperation(t.op)
+}
+
+func (t *operationTracker) update(fn func(op *store.Operation)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(&t.op)
+	t.op = t.s.saveOperation(t.op)
+}
+
+// startOperation persists a pending operation and runs fn in the background.
+func (s *Server) startOperation(kind, target, principal string, total int, initial interface{}, fn operationFunc) (store.Operation, error) {
+	return s.startOperationWithID(newOperationID(), kind, target, principal, total, initial, fn)
+}
+
+func newOperationID() string {
+	return ids.New(ids.Operation)
+}
+
+// startOperationWithID is startOperation for callers that must record the
+// operation ID elsewhere before the worker starts.
+func (s *Server) startOperationWithID(id, kind, target, principal string, total int, initial interface{}, fn operationFunc) (store.Operation, error) {
+	op := store.Operation{
+		OperationID: id,
+		Kind:        kind,
+		Target:      target,
+		Principal:   principal,
+		State:       store.OperationPending,
+		Progress:    store.OperationProgress{Total: total},
+	}
+	if initial != nil {
+		raw, err := json.Marshal(initial)
+		if err != nil {
+			return store.Operation{}, err
+		}
+		op.Result = raw
+	}
+	op, err := s.store.PutOperation(op)
+	if err != nil {
+		return store.Operation{}, err
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	s.ops.mu.Lock()
+	s.ops.cancels[op.OperationID] = cancel
+	s.ops.wg.Add(1)
+	s.ops.mu.Unlock()
+
+	go func() {
+		defer s.ops.wg.Done()
+		defer func() {
+			s.ops.mu.Lock()
+			delete(s.ops.cancels, op.OperationID)
+			s.ops.mu.Unlock()
+			cancel(nil)
+		}()
+
+		t := &operationTracker{s: s, op: op}
+		t.update(func(op *store.Operation) { op.State = store.OperationRunning })
+		result, err := fn(ctx, t)
+		t.update(func(op *store.Operation) {
+			now := time.Now().UTC()
+			op.CompletedAt = &now
+			switch {
+			case err == nil:
+				op.State = store.OperationSucceeded
+				if result != nil {
+					raw, merr := json.Marshal(result)
+					if merr != nil {
+						op.State = store.OperationFailed
+						op.Error = merr.Error()
+						return
+					}
+					op.Result = raw
+				}
+			case errors.Is(context.Cause(ctx), errOperationCancelled):
+				op.State = store.OperationCancelled
+				op.Error = err.Error()
+			default:
+				op.State = store.OperationFailed
+				op.Error = err.Error()
+			}
+		})
+	}()
+	return op, nil
+}
+
+// cancelOperation signals the worker of an in-flight operation. It reports
+// false when no worker is running for the ID.
+func (s *Server) cancelOperation(id string) bool {
+	s.ops.mu.Lock()
+	defer s.ops.mu.Unlock()
+	cancel, ok := s.ops.cancels[id]
+	if ok {
+		cancel(errOperationCancelled)
+	}
+	return ok
+}
+
+// Close stops the lease reaper and in-flight operation workers and waits for
+// them to record their final state. Operations interrupted this way are
+// reported as failed. Pending consumer notifications are flushed afterwards.
+func (s *Server) Close() {
+	close(s.reaperStop)
+	<-s.reaperDone
+	s.ops.mu.Lock()
+	for _, cancel := range s.ops.cancels {
+		cancel(errServerShutdown)
+	}
+	s.ops.mu.Unlock()
+	s.ops.wg.Wait()
+	if w, ok := s.notifier.(interface{ Wait() }); ok {
+		w.Wait()
+	}
+}
+
+func (s *Server) saveOperation(op store.Operation) store.Operation {
+	persisted, err := s.store.PutOperation(op)
+	if err != nil {
+		log.Printf("operation %s: persist failed: %v", op.OperationID, err)
+		return op
+	}
+	return persisted
+}
+
+// respondOperation answers an asynchronous request with 202 and a pointer to
+// the operation resource.
+func respondOperation(w http.ResponseWriter, op store.Operation) {
+	w.Header().Set("Location", "/v1/operations/"+op.OperationID)
+	respondJSON(w, http.StatusAccepted, op)
+}
+
+// preferAsync reports whether the client sent "Prefer: respond-async".
+func preferAsync(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Server) handleListOperations(w http.ResponseWriter, r *http.Request) {
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+
+	query := r.URL.Query()
+	kind, state, target := query.Get("kind"), query.Get("state"), query.Get("target")
+	ops := make([]store.Operation, 0)
+	for _, op := range s.store.ListOperations() {
+		if op.Principal != principal && !s.seesAll(r.Context()) {
+			continue
+		}
+		if (kind != "" && op.Kind != kind) || (state != "" && op.State != state) || (target != "" && op.Target != target) {
+			continue
+		}
+		ops = append(ops, op)
+	}
+	respondJSON(w, http.StatusOK, ops)
+}
+
+func (s *Server) handleGetOperation(w http.ResponseWriter, r *http.Request) {
+	op, ok := s.loadOperation(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, op)
+}
+
+func (s *Server) handleCancelOperation(w http.ResponseWriter, r *http.Request) {
+	op, ok := s.loadOperation(w, r)
+	if !ok {
+		return
+	}
+	if op.Terminal() {
+		respondError(w, http.StatusConflict, "operation_finished", "operation has already finished")
+		return
+	}
+
+	op, err := s.store.RequestOperationCancel(op.OperationID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+	if op.Terminal() || !s.cancelOperation(op.OperationID) {
+		respondError(w, http.StatusConflict, "operation_finished", "operation has already finished")
+		return
+	}
+	respondJSON(w, http.StatusAccepted, op)
+}
+
+// loadOperation resolves the {operationID} URL parameter and enforces that the
+// caller started the operation or may see every tenant's, writing an error
+// response otherwise.
+func (s *Server) loadOperation(w http.ResponseWriter, r *http.Request) (store.Operation, bool) {
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return store.Operation{}, false
+	}
+
+	op, err := s.store.GetOperation(chi.URLParam(r, "operationID"))
+	if err != nil {
+		if errors.Is(err, store.ErrOperationNotFound) {
+			respondError(w, http.StatusNotFound, "not_found", "operation not found")
+			return store.Operation{}, false
+		}
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return store.Operation{}, false
+	}
+	if op.Principal != principal && !s.seesAll(r.Context()) {
+		respondError(w, http.StatusForbidden, "principal_mismatch", "principal not authorised for this operation")
+		return store.Operation{}, false
+	}
+	return op, true
+}
@@ -0,0 +1,41 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/AtDexters-Lab/aionFS/internal/ids"
+)
+
+// page is a cursor over a list ordered by resource ID. Clients pass the last
+// ID they received as ?after= to fetch the next page.
+type page struct {
+	after string
+	limit int
+}
+
+// requestPage parses the ?after= and ?limit= query parameters, writing an
+// error response when limit is not a positive integer.
+func requestPage(w http.ResponseWriter, r *http.Request) (page, bool) {
+	q := r.URL.Query()
+	p := page{after: q.Get("after")}
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid_limit", "limit must be a positive integer")
+			return page{}, false
+		}
+		p.limit = n
+	}
+	return p, true
+}
+
+// admits reports whether id sorts after the cursor.
+func (p page) admits(id string) bool {
+	return p.after == "" || ids.Less(p.after, id)
+}
+
+// full reports whether n items fill the page.
+func (p page) full(n int) bool {
+	return p.limit > 0 && n >= p.limit
+}
@@ -0,0 +1,173 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/AtDexters-Lab/aionFS/internal/policy"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	auditActionProfileCreate = "policy-profile.create"
+	auditActionProfileUpdate = "policy-profile.update"
+	auditActionProfileDelete = "policy-profile.delete"
+)
+
+// quotaAllowed reports whether quota fits the policy's max_quota_bytes.
+func quotaAllowed(p policy.Policy, quota int64) bool {
+	return p.MaxQuotaBytes == 0 || quota <= p.MaxQuotaBytes
+}
+
+func respondQuotaExceedsPolicy(w http.ResponseWriter, eff policy.Effective) {
+	respondError(w, http.StatusBadRequest, "quota_exceeds_policy",
+		fmt.Sprintf("policy profile %q allows at most %d bytes", eff.Profile, eff.Policy.MaxQuotaBytes))
+}
+
+// respondPolicyError writes the response for a profile that failed to
+// resolve or validate.
+func respondPolicyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, policy.ErrProfileNotFound):
+		respondError(w, http.StatusBadRequest, "unknown_policy_profile", err.Error())
+	case errors.Is(err, policy.ErrInvalidProfile):
+		respondError(w, http.StatusBadRequest, "invalid_profile", err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+	}
+}
+
+func (s *Server) handleListProfiles(w http.ResponseWriter, _ *http.Request) {
+	respondJSON(w, http.StatusOK, s.store.ListProfiles())
+}
+
+func (s *Server) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.store.GetProfile(chi.URLParam(r, "profileName"))
+	if !ok {
+		respondError(w, http.StatusNotFound, "not_found", "policy profile not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleCreateProfile(w http.ResponseWriter, r *http.Request) {
+	principal, ok := s.authorizeProfileChange(w, r)
+	if !ok {
+		return
+	}
+	var p policy.Profile
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	if _, err := s.store.PutProfile(p, true); err != nil {
+		if errors.Is(err, store.ErrProfileExists) {
+			respondError(w, http.StatusConflict, "profile_exists", fmt.Sprintf("policy profile %q already exists", p.Name))
+			return
+		}
+		respondPolicyError(w, err)
+		return
+	}
+	s.recordAudit(principal, auditActionProfileCreate, p.Name, nil)
+	respondJSON(w, http.StatusCreated, p)
+}
+
+// handlePutProfile creates or replaces the named profile. Volumes already
+// using it keep their applied policy until their profile is changed again.
+func (s *Server) handlePutProfile(w http.ResponseWriter, r *http.Request) {
+	principal, ok := s.authorizeProfileChange(w, r)
+	if !ok {
+		return
+	}
+	name := chi.URLParam(r, "profileName")
+	var p policy.Profile
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	if p.Name == "" {
+		p.Name = name
+	} else if p.Name != name {
+		respondError(w, http.StatusBadRequest, "name_mismatch", "name does not match the profile in the path")
+		return
+	}
+	created, err := s.store.PutProfile(p, false)
+	if err != nil {
+		respondPolicyError(w, err)
+		return
+	}
+	if created {
+		s.recordAudit(principal, auditActionProfileCreate, p.Name, nil)
+		respondJSON(w, http.StatusCreated, p)
+		return
+	}
+	s.recordAudit(principal, auditActionProfileUpdate, p.Name, nil)
+	respondJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	principal, ok := s.authorizeProfileChange(w, r)
+	if !ok {
+		return
+	}
+	name := chi.URLParam(r, "profileName")
+	err := s.store.DeleteProfile(name)
+	switch {
+	case errors.Is(err, policy.ErrProfileNotFound):
+		respondError(w, http.StatusNotFound, "not_found", "policy profile not found")
+		return
+	case errors.Is(err, store.ErrProfileInUse):
+		respondError(w, http.StatusConflict, "profile_in_use", err.Error())
+		return
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+	s.recordAudit(principal, auditActionProfileDelete, name, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeProfileChange restricts profile writes to admins.
+func (s *Server) authorizeProfileChange(w http.ResponseWriter, r *http.Request) (string, bool) {
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return "", false
+	}
+	if !s.isAdmin(r.Context()) {
+		respondError(w, http.StatusForbidden, "admin_required", "changing policy profiles requires an admin principal")
+		return "", false
+	}
+	return principal, true
+}
+
+type effectivePolicyResponse struct {
+	VolumeID string `json:"volume_id"`
+	policy.Effective
+	// Applied is the policy the volume's backing currently satisfies. It
+	// differs from Policy while a migration is pending or after the profile
+	// has been edited.
+	Applied policy.Policy `json:"applied"`
+}
+
+// handleEffectivePolicy resolves the volume's profile and reports which
+// profile in the inheritance chain supplied each value.
+func (s *Server) handleEffectivePolicy(w http.ResponseWriter, r *http.Request) {
+	_, vol, ok := s.authorizeVolume(w, r, chi.URLParam(r, "volumeID"), store.VerbRead)
+	if !ok {
+		return
+	}
+	eff, err := s.store.ResolvePolicy(vol.PolicyProfile)
+	if err != nil {
+		respondPolicyError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, effectivePolicyResponse{
+		VolumeID:  vol.VolumeID,
+		Effective: eff,
+		Applied:   s.appliedPolicy(vol),
+	})
+}
@@ -0,0 +1,30 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/AtDexters-Lab/aionFS/internal/reload"
+)
+
+// WithReloadStatus exposes the reload history of the server's configuration
+// files at GET /v1/status/reloads.
+func WithReloadStatus(status func() []reload.Status) Option {
+	return func(s *Server) {
+		s.reloadStatus = status
+	}
+}
+
+// handleReloadStatus reports when each hot-reloadable file last loaded and
+// why its latest reload failed, if it did. Operators, admins and auditors
+// may read it.
+func (s *Server) handleReloadStatus(w http.ResponseWriter, r *http.Request) {
+	if !s.seesAll(r.Context()) {
+		respondError(w, http.StatusForbidden, "admin_required", "reload status requires an admin, operator or auditor principal")
+		return
+	}
+	statuses := []reload.Status{}
+	if s.reloadStatus != nil {
+		statuses = s.reloadStatus()
+	}
+	respondJSON(w, http.StatusOK, statuses)
+}
@@ -0,0 +1,252 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+	"github.com/AtDexters-Lab/aionFS/internal/policy"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	operationKindMigrate = "volume.migrate"
+
+	auditActionResize       = "volume.resize"
+	auditActionChangePolicy = "volume.change-policy"
+)
+
+var (
+	errVolumeBusy         = errors.New("volume is not available or attached")
+	errOfflineRequired    = errors.New("shrinking requires a detached volume")
+	errBelowUsage         = errors.New("quota is below current usage")
+	errMigrationScheduled = errors.New("policy migration in progress")
+)
+
+type resizeRequest struct {
+	QuotaBytes int64 `json:"quota_bytes"`
+}
+
+// handleResizeVolume changes a volume's quota. Growth is allowed while
+// attached; shrinking requires the volume to be detached.
+func (s *Server) handleResizeVolume(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	var req resizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	if req.QuotaBytes <= 0 {
+		respondError(w, http.StatusBadRequest, "invalid_quota", "quota_bytes must be positive")
+		return
+	}
+	principal, vol, ok := s.authorizeVolume(w, r, id, store.VerbManage)
+	if !ok {
+		return
+	}
+	eff, err := s.store.ResolvePolicy(vol.PolicyProfile)
+	if err != nil {
+		respondPolicyError(w, err)
+		return
+	}
+	if !quotaAllowed(eff.Policy, req.QuotaBytes) {
+		respondQuotaExceedsPolicy(w, eff)
+		return
+	}
+
+	release, ok := s.freezer.beginWrite(id)
+	if !ok {
+		respondVolumeFrozen(w)
+		return
+	}
+	defer release()
+
+	var previous store.Volume
+	persisted, err := s.store.ResizeVolume(id, req.QuotaBytes, func(v store.Volume) error {
+		previous = v
+		if v.AttachState != lifecycle.Available && v.AttachState != lifecycle.Attached {
+			return errVolumeBusy
+		}
+		if req.QuotaBytes < v.QuotaBytes {
+			if v.AttachState != lifecycle.Available {
+				return errOfflineRequired
+			}
+			if req.QuotaBytes < v.UsedBytes {
+				return errBelowUsage
+			}
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errVolumeBusy):
+		respondError(w, http.StatusConflict, "invalid_state", fmt.Sprintf("volume is %s", previous.AttachState))
+		return
+	case errors.Is(err, errOfflineRequired):
+		respondError(w, http.StatusConflict, "offline_required", "volume must be detached to shrink")
+		return
+	case errors.Is(err, errBelowUsage):
+		respondError(w, http.StatusConflict, "below_usage", fmt.Sprintf("quota_bytes is below current usage of %d bytes", previous.UsedBytes))
+		return
+	case err != nil:
+		respondVolumeError(w, err)
+		return
+	}
+
+	s.recordAudit(principal, auditActionResize, id, map[string]interface{}{
+		"from_bytes": previous.QuotaBytes,
+		"to_bytes":   persisted.QuotaBytes,
+		"online":     previous.AttachState == lifecycle.Attached,
+	})
+	respondJSON(w, http.StatusOK, persisted)
+}
+
+type changePolicyRequest struct {
+	PolicyProfile string `json:"policy_profile"`
+}
+
+// handleChangePolicy moves a volume to another policy profile. When the
+// resolved policy changes how data is laid out, a migration operation is
+// scheduled and reported in pending_migration until it completes.
+func (s *Server) handleChangePolicy(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	var req changePolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	if strings.TrimSpace(req.PolicyProfile) == "" {
+		respondError(w, http.StatusBadRequest, "missing_policy_profile", "policy_profile is required")
+		return
+	}
+	principal, vol, ok := s.authorizeVolume(w, r, id, store.VerbManage)
+	if !ok {
+		return
+	}
+	eff, err := s.store.ResolvePolicy(req.PolicyProfile)
+	if err != nil {
+		respondPolicyError(w, err)
+		return
+	}
+	if !quotaAllowed(eff.Policy, vol.QuotaBytes) {
+		respondQuotaExceedsPolicy(w, eff)
+		return
+	}
+
+	release, ok := s.freezer.beginWrite(id)
+	if !ok {
+		respondVolumeFrozen(w)
+		return
+	}
+	defer release()
+
+	target := eff.Policy
+	// Resolved outside UpdateVolume, which holds the store lock.
+	applied := s.appliedPolicy(vol)
+	operationID := newOperationID()
+	var (
+		previous store.Volume
+		migrate  bool
+	)
+	persisted, err := s.store.UpdateVolume(id, func(v *store.Volume) error {
+		previous = *v
+		if v.AttachState != lifecycle.Available && v.AttachState != lifecycle.Attached {
+			return errVolumeBusy
+		}
+		if v.PendingMigration != "" {
+			return errMigrationScheduled
+		}
+		current := applied
+		if v.Policy != nil {
+			current = *v.Policy
+		}
+		migrate = policy.NeedsMigration(current, target)
+		v.PolicyProfile = req.PolicyProfile
+		if migrate {
+			v.PendingMigration = operationID
+		} else {
+			v.Policy = &target
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errVolumeBusy):
+		respondError(w, http.StatusConflict, "invalid_state", fmt.Sprintf("volume is %s", previous.AttachState))
+		return
+	case errors.Is(err, errMigrationScheduled):
+		respondError(w, http.StatusConflict, "migration_in_progress", fmt.Sprintf("operation %s is still migrating this volume", previous.PendingMigration))
+		return
+	case err != nil:
+		respondVolumeError(w, err)
+		return
+	}
+
+	details := map[string]interface{}{
+		"from_profile": previous.PolicyProfile,
+		"to_profile":   req.PolicyProfile,
+	}
+	if migrate {
+		if _, err := s.startOperationWithID(operationID, operationKindMigrate, id, principal, 1, nil,
+			s.migrateVolume(id, previous.PolicyProfile, target, principal)); err != nil {
+			if _, rerr := s.store.UpdateVolume(id, func(v *store.Volume) error {
+				v.PolicyProfile = previous.PolicyProfile
+				v.PendingMigration = ""
+				return nil
+			}); rerr != nil {
+				err = fmt.Errorf("%w (reverting profile: %v)", err, rerr)
+			}
+			respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+			return
+		}
+		details["migration_operation"] = operationID
+	}
+
+	s.recordAudit(principal, auditActionChangePolicy, id, details)
+	respondJSON(w, http.StatusOK, persisted)
+}
+
+// migrateVolume returns the worker that rewrites a volume's data to satisfy
+// target. A cancelled migration restores the previous profile.
+func (s *Server) migrateVolume(volumeID, previousProfile string, target policy.Policy, principal string) operationFunc {
+	return func(ctx context.Context, t *operationTracker) (interface{}, error) {
+		if ctx.Err() != nil {
+			if _, err := s.store.UpdateVolume(volumeID, func(v *store.Volume) error {
+				v.PolicyProfile = previousProfile
+				v.PendingMigration = ""
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+			return nil, context.Cause(ctx)
+		}
+		persisted, err := s.store.UpdateVolume(volumeID, func(v *store.Volume) error {
+			v.Policy = &target
+			v.PendingMigration = ""
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		t.advance()
+		return persisted, nil
+	}
+}
+
+// appliedPolicy returns the policy a volume's backing satisfies. Volumes
+// recorded before policies were resolved use their profile's current policy,
+// or the defaults when the profile no longer resolves. It reads the store, so
+// it must not be called from a store mutation.
+func (s *Server) appliedPolicy(v store.Volume) policy.Policy {
+	if v.Policy != nil {
+		return *v.Policy
+	}
+	eff, err := s.store.ResolvePolicy(v.PolicyProfile)
+	if err != nil {
+		return policy.Defaults
+	}
+	return eff.Policy
+}
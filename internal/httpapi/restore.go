@@ -0,0 +1,211 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/AtDexters-Lab/aionFS/internal/ids"
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+const (
+	restoreModeClone    = "clone"
+	restoreModeRollback = "rollback"
+
+	operationKindRestore = "checkpoint.restore"
+)
+
+type restoreRequest struct {
+	// Mode is "clone" (default) to create new volumes or "rollback" to
+	// restore the original volumes in place.
+	Mode string `json:"mode,omitempty"`
+}
+
+type restoreResult struct {
+	Mode      string            `json:"mode"`
+	VolumeMap map[string]string `json:"volume_map"`
+}
+
+// restoreStep restores one snapshot of the manifest into targetID.
+type restoreStep struct {
+	snapshot store.Snapshot
+	source   store.Volume
+	targetID string
+	owner    string
+}
+
+func (s *Server) handleRestoreCheckpoint(w http.ResponseWriter, r *http.Request) {
+	cp, ok := s.loadCheckpoint(w, r)
+	if !ok {
+		return
+	}
+	principal, _ := principalFromContext(r.Context())
+
+	var req restoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = restoreModeClone
+	}
+	if req.Mode != restoreModeClone && req.Mode != restoreModeRollback {
+		respondError(w, http.StatusBadRequest, "invalid_mode", fmt.Sprintf("unsupported restore mode %q", req.Mode))
+		return
+	}
+	if req.Mode == restoreModeClone && tokenRestricted(r.Context()) {
+		respondError(w, http.StatusForbidden, "token_restricted", "token is limited to existing volumes")
+		return
+	}
+	if len(cp.SnapshotIDs) == 0 {
+		respondError(w, http.StatusConflict, "empty_checkpoint", "checkpoint references no snapshots")
+		return
+	}
+
+	steps := make([]restoreStep, 0, len(cp.SnapshotIDs))
+	volumeMap := make(map[string]string, len(cp.SnapshotIDs))
+	for _, sid := range cp.SnapshotIDs {
+		snap, err := s.store.GetSnapshot(sid)
+		if err != nil {
+			respondError(w, http.StatusConflict, "missing_snapshot", fmt.Sprintf("checkpoint references missing snapshot %s", sid))
+			return
+		}
+		source, err := s.store.GetVolume(snap.VolumeID)
+		if err != nil {
+			respondError(w, http.StatusConflict, "missing_volume", fmt.Sprintf("source volume %s for snapshot %s no longer exists", snap.VolumeID, sid))
+			return
+		}
+		if _, dup := volumeMap[source.VolumeID]; dup {
+			respondError(w, http.StatusConflict, "duplicate_volume", fmt.Sprintf("checkpoint references volume %s more than once", source.VolumeID))
+			return
+		}
+		// A clone copies the source's data, so it needs the same permission
+		// as rolling the source back.
+		if !s.authorized(r.Context(), source, store.VerbRestore) {
+			respondError(w, http.StatusForbidden, "principal_mismatch", fmt.Sprintf("principal not authorised for restore on volume %s", source.VolumeID))
+			return
+		}
+		step := restoreStep{snapshot: snap, source: source, owner: source.OwnerPrincipal}
+		if req.Mode == restoreModeClone {
+			step.targetID = ids.New(ids.Volume)
+			if s.authEnabled() {
+				step.owner = principal
+			}
+		} else {
+			step.targetID = source.VolumeID
+		}
+		volumeMap[source.VolumeID] = step.targetID
+		steps = append(steps, step)
+	}
+
+	op, err := s.startOperation(operationKindRestore, cp.ManifestID, principal, len(steps),
+		restoreResult{Mode: req.Mode, VolumeMap: volumeMap},
+		func(ctx context.Context, t *operationTracker) (interface{}, error) {
+			return nil, s.runRestore(ctx, t, req.Mode, steps)
+		})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+	respondOperation(w, op)
+}
+
+// runRestore applies every step in order. When a step fails or the operation
+// is cancelled, the steps that already completed are reverted in reverse
+// order.
+func (s *Server) runRestore(ctx context.Context, t *operationTracker, mode string, steps []restoreStep) error {
+	reverts := make([]func() error, 0, len(steps))
+	undo := func() {
+		for i := len(reverts) - 1; i >= 0; i-- {
+			if err := reverts[i](); err != nil {
+				log.Printf("operation %s: revert failed: %v", t.op.OperationID, err)
+			}
+		}
+	}
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			undo()
+			return context.Cause(ctx)
+		}
+		var (
+			revert func() error
+			err    error
+		)
+		if mode == restoreModeClone {
+			revert, err = s.restoreClone(step)
+		} else {
+			revert, err = s.restoreRollback(step)
+		}
+		if err != nil {
+			undo()
+			return fmt.Errorf("restore of snapshot %s into %s failed: %w", step.snapshot.SnapshotID, step.targetID, err)
+		}
+		reverts = append(reverts, revert)
+		t.advance()
+	}
+	return nil
+}
+
+// restoreClone provisions a new volume seeded from the step's snapshot.
+func (s *Server) restoreClone(step restoreStep) (func() error, error) {
+	v := store.Volume{
+		VolumeID:       step.targetID,
+		OwnerPrincipal: step.owner,
+		Class:          step.source.Class,
+		QuotaBytes:     step.source.QuotaBytes,
+		PolicyProfile:  step.source.PolicyProfile,
+		Policy:         step.source.Policy,
+		ExportMode:     step.source.ExportMode,
+		AccessMode:     step.source.AccessMode,
+		Labels:         step.source.Labels,
+		Annotations:    step.source.Annotations,
+		ExpiresAt:      s.ephemeralExpiry(step.source.Class, 0),
+		MountHandle:    newMountInfo(step.targetID, step.source.ExportMode, lifecycle.Available),
+		AttachState:    lifecycle.Available,
+		RestoredFrom:   step.snapshot.SnapshotID,
+		Transitions: []lifecycle.Transition{
+			lifecycle.Initial(lifecycle.Available, "restored from snapshot "+step.snapshot.SnapshotID, step.owner),
+		},
+	}
+	if _, err := s.store.PutVolume(v); err != nil {
+		return nil, err
+	}
+	return func() error {
+		return s.deleteVolume(step.targetID, "restore rolled back", step.owner)
+	}, nil
+}
+
+// restoreRollback rewinds an existing, detached volume to the step's snapshot.
+func (s *Server) restoreRollback(step restoreStep) (func() error, error) {
+	release, ok := s.freezer.beginWrite(step.targetID)
+	if !ok {
+		return nil, errors.New("volume is frozen by a consistency group capture")
+	}
+	defer release()
+
+	var previous string
+	_, err := s.store.UpdateVolume(step.targetID, func(v *store.Volume) error {
+		if v.AttachState != lifecycle.Available {
+			return fmt.Errorf("volume is %s", v.AttachState)
+		}
+		previous = v.RestoredFrom
+		v.RestoredFrom = step.snapshot.SnapshotID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := s.store.UpdateVolume(step.targetID, func(v *store.Volume) error {
+			v.RestoredFrom = previous
+			return nil
+		})
+		return err
+	}, nil
+}
@@ -0,0 +1,60 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/AtDexters-Lab/aionFS/internal/auth"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+// TestRestoreRequiresRestorePermission checks both restore modes against a
+// token that may see the checkpoint but not restore its volumes.
+func TestRestoreRequiresRestorePermission(t *testing.T) {
+	tokens := tokenTable{
+		"owner":    {Principal: "svc", Role: auth.RoleTenant},
+		"snapshot": {Principal: "svc", Role: auth.RoleTenant, Scopes: []string{store.VerbSnapshot}},
+	}
+	s, _ := newTestServer(t, tokens)
+	h := s.Router()
+	vol := createVolume(t, h, "svc", bearer("owner")...)
+	rec := request(t, h, http.MethodPost, "/v1/checkpoints", createCheckpointRequest{
+		VolumeIDs: []string{vol.VolumeID},
+	}, bearer("owner")...)
+	expectStatus(t, rec, http.StatusCreated)
+	cp := decodeBody[store.Checkpoint](t, rec)
+
+	path := "/v1/checkpoints/" + cp.ManifestID + "/restore"
+	for _, mode := range []string{restoreModeClone, restoreModeRollback} {
+		t.Run(mode, func(t *testing.T) {
+			rec := request(t, h, http.MethodPost, path, restoreRequest{Mode: mode}, bearer("snapshot")...)
+			expectStatus(t, rec, http.StatusForbidden)
+			rec = request(t, h, http.MethodPost, path, restoreRequest{Mode: mode}, bearer("owner")...)
+			expectStatus(t, rec, http.StatusAccepted)
+		})
+	}
+}
+
+// TestRestrictedTokenCannotClone checks that a token limited to a volume may
+// roll it back but not clone it into a volume outside its scope.
+func TestRestrictedTokenCannotClone(t *testing.T) {
+	tokens := tokenTable{"owner": {Principal: "svc", Role: auth.RoleTenant}}
+	s, _ := newTestServer(t, tokens)
+	h := s.Router()
+	vol := createVolume(t, h, "svc", bearer("owner")...)
+	tokens["restricted"] = auth.Identity{Principal: "svc", Role: auth.RoleTenant, Volumes: []string{vol.VolumeID}}
+	rec := request(t, h, http.MethodPost, "/v1/checkpoints", createCheckpointRequest{
+		VolumeIDs: []string{vol.VolumeID},
+	}, bearer("owner")...)
+	expectStatus(t, rec, http.StatusCreated)
+	cp := decodeBody[store.Checkpoint](t, rec)
+
+	path := "/v1/checkpoints/" + cp.ManifestID + "/restore"
+	rec = request(t, h, http.MethodPost, path, restoreRequest{Mode: restoreModeClone}, bearer("restricted")...)
+	expectStatus(t, rec, http.StatusForbidden)
+	if code := decodeBody[errorResponse](t, rec).Error; code != "token_restricted" {
+		t.Fatalf("error = %q, want token_restricted", code)
+	}
+	rec = request(t, h, http.MethodPost, path, restoreRequest{Mode: restoreModeRollback}, bearer("restricted")...)
+	expectStatus(t, rec, http.StatusAccepted)
+}
@@ -3,72 +3,211 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
 	"net/http"
-	"path"
 	"strings"
 	"time"
 
 	"github.com/AtDexters-Lab/aionFS/internal/auth"
+	"github.com/AtDexters-Lab/aionFS/internal/notify"
+	"github.com/AtDexters-Lab/aionFS/internal/reload"
 	"github.com/AtDexters-Lab/aionFS/internal/store"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/google/uuid"
 )
 
-const (
-	mountStatePreparing = "preparing"
-	mountStateAttached  = "attached"
-	mountStateAvailable = "available"
-)
+// defaultNotifyTimeout bounds each delivery to a consumer endpoint.
+const defaultNotifyTimeout = 5 * time.Second
 
 // Server exposes the dev HTTP interface.
 type Server struct {
-	store  *store.FileStore
-	tokens auth.TokenProvider
+	store        *store.FileStore
+	tokens       auth.TokenProvider
+	freezer      *freezer
+	ops          *operationRunner
+	capsuleLimit int64
+	admins       map[string]struct{}
+	notifier     notify.Notifier
+	clock        func() time.Time
+	leaseTTL     time.Duration
+	ephemeralTTL time.Duration
+	// idempotencyTTL is how long responses to keyed POSTs are replayable.
+	idempotencyTTL time.Duration
+	inflight       *inflightKeys
+	// certs maps client certificates to identities; authMode decides how
+	// they combine with bearer tokens.
+	certs        *auth.CertMapper
+	authMode     AuthMode
+	reloadStatus func() []reload.Status
+	// issuer mints tokens for the client certificates named in minters.
+	issuer     *auth.Issuer
+	minters    map[string]struct{}
+	reaperStop chan struct{}
+	reaperDone chan struct{}
+}
+
+// Option customises optional Server behaviour.
+type Option func(*Server)
+
+// WithCapsuleLimit caps the size of checkpoint capsule payloads in bytes.
+func WithCapsuleLimit(limit int64) Option {
+	return func(s *Server) {
+		if limit > 0 {
+			s.capsuleLimit = limit
+		}
+	}
+}
+
+// WithAdmins grants the listed principals administrative overrides such as
+// force-deleting attached volumes.
+func WithAdmins(principals ...string) Option {
+	return func(s *Server) {
+		for _, p := range principals {
+			if p = strings.TrimSpace(p); p != "" {
+				s.admins[p] = struct{}{}
+			}
+		}
+	}
+}
+
+// WithNotifier replaces the notifier used to tell consumer endpoints about
+// sessions torn down from outside.
+func WithNotifier(n notify.Notifier) Option {
+	return func(s *Server) {
+		if n != nil {
+			s.notifier = n
+		}
+	}
+}
+
+// WithClock replaces the clock used for session leases.
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		if now != nil {
+			s.clock = now
+		}
+	}
+}
+
+// WithLeaseTTL sets the default attach lease duration.
+func WithLeaseTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		if ttl > 0 {
+			s.leaseTTL = ttl
+		}
+	}
+}
+
+// WithEphemeralTTL sets how long ephemeral volumes live when the create
+// request does not ask for a lifetime.
+func WithEphemeralTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		if ttl > 0 {
+			s.ephemeralTTL = ttl
+		}
+	}
+}
+
+// WithIdempotencyTTL sets how long responses to requests carrying an
+// Idempotency-Key are kept for replay.
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		if ttl > 0 {
+			s.idempotencyTTL = ttl
+		}
+	}
+}
+
+// WithTokenIssuer enables POST /v1/auth/tokens for clients presenting a
+// verified certificate whose common name is listed in minters.
+func WithTokenIssuer(issuer *auth.Issuer, minters ...string) Option {
+	return func(s *Server) {
+		s.issuer = issuer
+		for _, m := range minters {
+			if m = strings.TrimSpace(m); m != "" {
+				s.minters[m] = struct{}{}
+			}
+		}
+	}
 }
 
 // NewServer constructs a new HTTP server wrapper.
-func NewServer(st *store.FileStore, tokens auth.TokenProvider) *Server {
-	return &Server{store: st, tokens: tokens}
+func NewServer(st *store.FileStore, tokens auth.TokenProvider, opts ...Option) *Server {
+	s := &Server{
+		store:        st,
+		tokens:       tokens,
+		freezer:      newFreezer(),
+		ops:          newOperationRunner(),
+		capsuleLimit: defaultCapsuleLimit,
+		admins:       map[string]struct{}{},
+		notifier:     notify.NewHTTPNotifier(defaultNotifyTimeout),
+		clock:        time.Now,
+		leaseTTL:     defaultLeaseTTL,
+		ephemeralTTL: defaultEphemeralTTL,
+
+		idempotencyTTL: defaultIdempotencyTTL,
+		inflight:       newInflightKeys(),
+		minters:        map[string]struct{}{},
+		authMode:       AuthToken,
+		reaperStop:     make(chan struct{}),
+		reaperDone:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	go s.runReaper()
+	return s
 }
 
-type principalKey struct{}
+type identityKey struct{}
 
 func (s *Server) requireAuth() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if s.tokens == nil {
+			if !s.authEnabled() {
 				next.ServeHTTP(w, r)
 				return
 			}
-			authz := r.Header.Get("Authorization")
-			if !strings.HasPrefix(authz, "Bearer ") {
-				respondError(w, http.StatusUnauthorized, "unauthorized", "missing bearer token")
+			id, ok := s.authenticate(w, r)
+			if !ok {
 				return
 			}
-			token := strings.TrimSpace(strings.TrimPrefix(authz, "Bearer "))
-			principal, ok := s.tokens.Principal(token)
-			if !ok {
-				respondError(w, http.StatusUnauthorized, "unauthorized", "invalid token")
+			if _, ok := s.admins[id.Principal]; ok {
+				id.Role = auth.RoleAdmin
+			}
+			if id.Role == auth.RoleAuditor && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				respondError(w, http.StatusForbidden, "read_only_role", "auditors cannot change resources")
 				return
 			}
-			ctx := context.WithValue(r.Context(), principalKey{}, principal)
+			if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+				info.principal = id.Principal
+			}
+			ctx := context.WithValue(r.Context(), identityKey{}, id)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// identityFromContext returns the identity requireAuth authenticated.
+func identityFromContext(ctx context.Context) (auth.Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(auth.Identity)
+	return id, ok
+}
+
 func principalFromContext(ctx context.Context) (string, bool) {
-	principal, ok := ctx.Value(principalKey{}).(string)
-	return principal, ok
+	id, ok := identityFromContext(ctx)
+	return id.Principal, ok
+}
+
+// isAdmin reports whether the caller may use administrative overrides.
+// Without token auth every caller is trusted.
+func (s *Server) isAdmin(ctx context.Context) bool {
+	return !s.authEnabled() || roleOf(ctx) == auth.RoleAdmin
 }
 
 // Router builds the chi router with all routes mounted.
 func (s *Server) Router() http.Handler {
 	r := chi.NewRouter()
+	r.Use(logRequests)
 	r.Use(jsonMiddleware)
 	r.Use(middleware.StripSlashes)
 
@@ -76,19 +215,60 @@ func (s *Server) Router() http.Handler {
 		respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 	})
 
+	// Minting authenticates by client certificate rather than bearer token.
+	r.Post("/v1/auth/tokens", s.handleMintToken)
+	r.Delete("/v1/auth/tokens/{tokenID}", s.handleRevokeToken)
+
 	r.Route("/v1", func(r chi.Router) {
-		if s.tokens != nil {
+		if s.authEnabled() {
 			r.Use(s.requireAuth())
 		}
+		r.Use(s.idempotency)
+		r.Get("/auth/whoami", s.handleWhoami)
+		r.Get("/status/reloads", s.handleReloadStatus)
 		r.Post("/volumes", s.handleCreateVolume)
 		r.Get("/volumes", s.handleListVolumes)
+		r.Get("/volumes/by-name/{name}", s.handleGetVolumeByName)
 		r.Post("/checkpoints", s.handleCreateCheckpoint)
 		r.Get("/checkpoints", s.handleListCheckpoints)
+		r.Post("/checkpoints:import", s.handleImportArchive)
+		r.Route("/checkpoints/{checkpointID}", func(r chi.Router) {
+			r.Get("/", s.handleGetCheckpoint)
+			r.Patch("/", s.handlePatchCheckpoint)
+			r.Put("/capsule", s.handlePutCapsule)
+			r.Get("/capsule", s.handleGetCapsule)
+			r.Post("/restore", s.handleRestoreCheckpoint)
+			r.Get("/archive", s.handleExportArchive)
+		})
+		r.Get("/audit", s.handleListAudit)
+		r.Get("/policy-profiles", s.handleListProfiles)
+		r.Post("/policy-profiles", s.handleCreateProfile)
+		r.Route("/policy-profiles/{profileName}", func(r chi.Router) {
+			r.Get("/", s.handleGetProfile)
+			r.Put("/", s.handlePutProfile)
+			r.Delete("/", s.handleDeleteProfile)
+		})
+		r.Get("/sessions", s.handleListSessions)
+		r.Get("/operations", s.handleListOperations)
+		r.Get("/operations/{operationID}", s.handleGetOperation)
+		r.Delete("/operations/{operationID}", s.handleCancelOperation)
+		r.Post("/volumes/{volumeID}:resize", s.handleResizeVolume)
+		r.Post("/volumes/{volumeID}:change-policy", s.handleChangePolicy)
 		r.Route("/volumes/{volumeID}", func(r chi.Router) {
 			r.Get("/", s.handleGetVolume)
+			r.Patch("/", s.handlePatchVolume)
+			r.Get("/effective-policy", s.handleEffectivePolicy)
 			r.Post("/attach", s.handleAttachVolume)
 			r.Post("/detach", s.handleDetachVolume)
+			r.Post("/force-detach", s.handleForceDetachVolume)
+			r.Get("/acl", s.handleGetACL)
+			r.Put("/acl", s.handlePutACL)
+			r.Post("/transfer", s.handleTransferVolume)
+			r.Post("/transfer/accept", s.handleAcceptTransfer)
+			r.Delete("/transfer", s.handleCancelTransfer)
+			r.Post("/sessions/{sessionID}/heartbeat", s.handleHeartbeat)
 			r.Post("/snapshots", s.handleCreateSnapshot)
+			r.Patch("/snapshots/{snapshotID}", s.handlePatchSnapshot)
 			r.Get("/snapshots", s.handleListSnapshots)
 			r.Delete("/", s.handleDeleteVolume)
 		})
@@ -97,258 +277,11 @@ func (s *Server) Router() http.Handler {
 	return r
 }
 
-type createVolumeRequest struct {
-	OwnerPrincipal string `json:"owner_principal"`
-	Class          string `json:"class"`
-	QuotaBytes     int64  `json:"quota_bytes"`
-	PolicyProfile  string `json:"policy_profile"`
-	ExportMode     string `json:"export_mode"`
-}
-
 type errorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
 }
 
-func (s *Server) handleCreateVolume(w http.ResponseWriter, r *http.Request) {
-	var req createVolumeRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
-		return
-	}
-	principal, havePrincipal := principalFromContext(r.Context())
-	if s.tokens != nil {
-		if !havePrincipal {
-			respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
-			return
-		}
-	}
-
-	if req.OwnerPrincipal == "" {
-		if s.tokens != nil {
-			req.OwnerPrincipal = principal
-		} else {
-			respondError(w, http.StatusBadRequest, "missing_owner", "owner_principal is required")
-			return
-		}
-	} else if s.tokens != nil && req.OwnerPrincipal != principal {
-		respondError(w, http.StatusForbidden, "principal_mismatch", "owner must match token principal")
-		return
-	}
-	if req.ExportMode == "" {
-		req.ExportMode = "fs"
-	}
-	if req.Class == "" {
-		req.Class = "persistent"
-	}
-
-	volumeID := "vol-" + strings.ToLower(uuid.NewString()[:8])
-	hostPath := path.Join("/run/aionfs/mounts", volumeID)
-
-	v := store.Volume{
-		VolumeID:       volumeID,
-		OwnerPrincipal: req.OwnerPrincipal,
-		Class:          req.Class,
-		QuotaBytes:     req.QuotaBytes,
-		PolicyProfile:  req.PolicyProfile,
-		ExportMode:     req.ExportMode,
-		MountHandle: store.MountInfo{
-			Mode:     req.ExportMode,
-			HostPath: hostPath,
-			State:    mountStateAvailable,
-		},
-		AttachState: mountStateAvailable,
-	}
-
-	persisted, err := s.store.PutVolume(v)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-
-	respondJSON(w, http.StatusCreated, persisted)
-}
-
-func (s *Server) handleListVolumes(w http.ResponseWriter, r *http.Request) {
-	principal, ok := principalFromContext(r.Context())
-	if s.tokens != nil && !ok {
-		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
-		return
-	}
-
-	var volumes []store.Volume
-	if s.tokens != nil {
-		volumes = s.store.ListVolumesByOwner(principal)
-	} else {
-		volumes = s.store.ListVolumes()
-	}
-	respondJSON(w, http.StatusOK, volumes)
-}
-
-func (s *Server) handleGetVolume(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "volumeID")
-	v, err := s.store.GetVolume(id)
-	if err != nil {
-		if errors.Is(err, store.ErrVolumeNotFound) {
-			respondError(w, http.StatusNotFound, "not_found", "volume not found")
-			return
-		}
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-
-	if principal, ok := principalFromContext(r.Context()); s.tokens != nil {
-		if !ok {
-			respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
-			return
-		}
-		if v.OwnerPrincipal != principal {
-			respondError(w, http.StatusForbidden, "principal_mismatch", "principal not authorised for this volume")
-			return
-		}
-	}
-
-	respondJSON(w, http.StatusOK, v)
-}
-
-type attachRequest struct {
-	Principal        string `json:"principal"`
-	SessionID        string `json:"session_id"`
-	ConsumerEndpoint string `json:"consumer_endpoint"`
-}
-
-func (s *Server) handleAttachVolume(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "volumeID")
-	var req attachRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
-		return
-	}
-	principal, havePrincipal := principalFromContext(r.Context())
-	if s.tokens != nil && !havePrincipal {
-		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
-		return
-	}
-	vol, err := s.store.GetVolume(id)
-	if err != nil {
-		if errors.Is(err, store.ErrVolumeNotFound) {
-			respondError(w, http.StatusNotFound, "not_found", "volume not found")
-			return
-		}
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-	if req.Principal == "" {
-		if s.tokens != nil {
-			req.Principal = principal
-		} else {
-			respondError(w, http.StatusBadRequest, "missing_principal", "principal is required")
-			return
-		}
-	}
-	if req.Principal != vol.OwnerPrincipal {
-		respondError(w, http.StatusForbidden, "principal_mismatch", "principal not authorised for this volume")
-		return
-	}
-	if req.SessionID == "" {
-		req.SessionID = "sess-" + strings.ToLower(uuid.NewString()[:8])
-	}
-
-	vol.AttachState = mountStateAttached
-	vol.MountHandle.State = mountStateAttached
-	vol.AttachSession = &store.Session{
-		SessionID:        req.SessionID,
-		Principal:        req.Principal,
-		ConsumerEndpoint: req.ConsumerEndpoint,
-		AttachedAt:       time.Now().UTC(),
-	}
-
-	persisted, err := s.store.PutVolume(vol)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-
-	respondJSON(w, http.StatusOK, persisted)
-}
-
-type detachRequest struct {
-	SessionID string `json:"session_id"`
-}
-
-func (s *Server) handleDetachVolume(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "volumeID")
-	var req detachRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
-		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
-		return
-	}
-	vol, err := s.store.GetVolume(id)
-	if err != nil {
-		if errors.Is(err, store.ErrVolumeNotFound) {
-			respondError(w, http.StatusNotFound, "not_found", "volume not found")
-			return
-		}
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-
-	if principal, ok := principalFromContext(r.Context()); s.tokens != nil {
-		if !ok {
-			respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
-			return
-		}
-		if vol.OwnerPrincipal != principal {
-			respondError(w, http.StatusForbidden, "principal_mismatch", "principal not authorised for this volume")
-			return
-		}
-	}
-
-	vol.AttachState = mountStateAvailable
-	vol.MountHandle.State = mountStateAvailable
-	vol.AttachSession = nil
-
-	persisted, err := s.store.PutVolume(vol)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-	respondJSON(w, http.StatusOK, persisted)
-}
-
-func (s *Server) handleDeleteVolume(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "volumeID")
-	if principal, ok := principalFromContext(r.Context()); s.tokens != nil {
-		if !ok {
-			respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
-			return
-		}
-		vol, err := s.store.GetVolume(id)
-		if err != nil {
-			if errors.Is(err, store.ErrVolumeNotFound) {
-				respondError(w, http.StatusNotFound, "not_found", "volume not found")
-				return
-			}
-			respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-			return
-		}
-		if vol.OwnerPrincipal != principal {
-			respondError(w, http.StatusForbidden, "principal_mismatch", "principal not authorised for this volume")
-			return
-		}
-	}
-
-	if err := s.store.DeleteVolume(id); err != nil {
-		if errors.Is(err, store.ErrVolumeNotFound) {
-			respondError(w, http.StatusNotFound, "not_found", "volume not found")
-			return
-		}
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-	w.WriteHeader(http.StatusNoContent)
-}
-
 func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
 	w.WriteHeader(status)
 	if payload == nil {
@@ -359,198 +292,14 @@ func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
 	}
 }
 
-type createSnapshotRequest struct {
-	Note string `json:"note,omitempty"`
-}
-
-type createCheckpointRequest struct {
-	VolumeIDs []string `json:"volume_ids"`
-	Note      string   `json:"note,omitempty"`
-}
-
-func (s *Server) handleCreateSnapshot(w http.ResponseWriter, r *http.Request) {
-	volumeID := chi.URLParam(r, "volumeID")
-	principal, ok := principalFromContext(r.Context())
-	if s.tokens != nil && !ok {
-		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
-		return
-	}
-
-	vol, err := s.store.GetVolume(volumeID)
-	if err != nil {
-		if errors.Is(err, store.ErrVolumeNotFound) {
-			respondError(w, http.StatusNotFound, "not_found", "volume not found")
-			return
-		}
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-	if s.tokens != nil && vol.OwnerPrincipal != principal {
-		respondError(w, http.StatusForbidden, "principal_mismatch", "principal not authorised for this volume")
-		return
-	}
-
-	var req createSnapshotRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
-		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
-		return
-	}
-
-	snapshot := store.Snapshot{
-		SnapshotID: "snap-" + strings.ToLower(uuid.NewString()[:8]),
-		VolumeID:   volumeID,
-		CreatedAt:  time.Now().UTC(),
-		Note:       req.Note,
-	}
-	persisted, err := s.store.AddSnapshot(volumeID, snapshot)
-	if err != nil {
-		if errors.Is(err, store.ErrVolumeNotFound) {
-			respondError(w, http.StatusNotFound, "not_found", "volume not found")
-			return
-		}
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-
-	respondJSON(w, http.StatusCreated, persisted)
-}
-
-func (s *Server) handleListSnapshots(w http.ResponseWriter, r *http.Request) {
-	volumeID := chi.URLParam(r, "volumeID")
-	principal, ok := principalFromContext(r.Context())
-	if s.tokens != nil && !ok {
-		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
-		return
-	}
-
-	vol, err := s.store.GetVolume(volumeID)
-	if err != nil {
-		if errors.Is(err, store.ErrVolumeNotFound) {
-			respondError(w, http.StatusNotFound, "not_found", "volume not found")
-			return
-		}
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-	if s.tokens != nil && vol.OwnerPrincipal != principal {
-		respondError(w, http.StatusForbidden, "principal_mismatch", "principal not authorised for this volume")
-		return
-	}
-
-	snaps := s.store.ListSnapshots(volumeID)
-	respondJSON(w, http.StatusOK, snaps)
-}
-
-func (s *Server) handleCreateCheckpoint(w http.ResponseWriter, r *http.Request) {
-	principal, ok := principalFromContext(r.Context())
-	if s.tokens != nil && !ok {
-		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
-		return
-	}
-
-	var req createCheckpointRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
-		return
-	}
-
-	volumeIDs := req.VolumeIDs
-	if len(volumeIDs) == 0 {
-		if s.tokens != nil {
-			volumeIDs = make([]string, 0)
-			for _, v := range s.store.ListVolumesByOwner(principal) {
-				volumeIDs = append(volumeIDs, v.VolumeID)
-			}
-		} else {
-			for _, v := range s.store.ListVolumes() {
-				volumeIDs = append(volumeIDs, v.VolumeID)
-			}
-		}
-	}
-
-	snapshotIDs := make([]string, 0, len(volumeIDs))
-	for _, vid := range volumeIDs {
-		vol, err := s.store.GetVolume(vid)
-		if err != nil {
-			respondError(w, http.StatusBadRequest, "invalid_volume", fmt.Sprintf("unknown volume %s", vid))
-			return
-		}
-		if s.tokens != nil && vol.OwnerPrincipal != principal {
-			respondError(w, http.StatusForbidden, "principal_mismatch", fmt.Sprintf("principal not authorised for volume %s", vid))
-			return
-		}
-		latest, ok := s.store.LatestSnapshot(vid)
-		if !ok {
-			created, err := s.store.AddSnapshot(vid, store.Snapshot{
-				SnapshotID: "snap-" + strings.ToLower(uuid.NewString()[:8]),
-				VolumeID:   vid,
-				CreatedAt:  time.Now().UTC(),
-				Note:       "auto-generated for checkpoint",
-			})
-			if err != nil {
-				respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-				return
-			}
-			latest = created
-		}
-		snapshotIDs = append(snapshotIDs, latest.SnapshotID)
-	}
-
-	manifest := store.Checkpoint{
-		ManifestID:  "chk-" + strings.ToLower(uuid.NewString()[:8]),
-		SnapshotIDs: snapshotIDs,
-		CreatedAt:   time.Now().UTC(),
-		Note:        req.Note,
-	}
-
-	persisted, err := s.store.PutCheckpoint(manifest)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
-		return
-	}
-
-	respondJSON(w, http.StatusCreated, persisted)
-}
-
-func (s *Server) handleListCheckpoints(w http.ResponseWriter, r *http.Request) {
-	principal, ok := principalFromContext(r.Context())
-	if s.tokens != nil && !ok {
-		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
-		return
-	}
-
-	manifests := s.store.ListCheckpoints()
-	if s.tokens != nil {
-		// Filter manifests to only those referencing the caller's volumes.
-		allowed := make([]store.Checkpoint, 0, len(manifests))
-		owned := map[string]struct{}{}
-		for _, v := range s.store.ListVolumesByOwner(principal) {
-			owned[v.VolumeID] = struct{}{}
-		}
-		for _, cp := range manifests {
-			include := true
-			for _, sid := range cp.SnapshotIDs {
-				if vid, ok := s.store.VolumeIDForSnapshot(sid); ok {
-					if _, ownedVol := owned[vid]; !ownedVol {
-						include = false
-						break
-					}
-				}
-			}
-			if include {
-				allowed = append(allowed, cp)
-			}
-		}
-		manifests = allowed
-	}
-
-	respondJSON(w, http.StatusOK, manifests)
-}
-
 func respondError(w http.ResponseWriter, status int, code, message string) {
 	respondJSON(w, status, errorResponse{Error: code, Message: message})
 }
 
+func respondVolumeFrozen(w http.ResponseWriter) {
+	respondError(w, http.StatusLocked, "volume_frozen", "volume is frozen by a consistency group capture")
+}
+
 func jsonMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,324 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+	"github.com/AtDexters-Lab/aionFS/internal/notify"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultLeaseTTL = 60 * time.Second
+	fencingHeader   = "X-Fencing-Generation"
+	reapInterval    = time.Second
+
+	// reaperPrincipal is recorded on transitions made by the lease reaper.
+	reaperPrincipal = "system:lease-reaper"
+)
+
+var (
+	errPrincipalMismatch = errors.New("principal mismatch")
+	errSessionNotFound   = errors.New("session not found")
+	errLeaseExpired      = errors.New("lease expired")
+	errLeaseActive       = errors.New("lease still active")
+	errMissingGeneration = errors.New("fencing generation required")
+	errStaleGeneration   = errors.New("stale fencing generation")
+)
+
+func (s *Server) now() time.Time {
+	return s.clock().UTC()
+}
+
+// leaseDuration returns the attach lease for volumes using profile: the
+// profile's lease_ttl_seconds when it sets one, otherwise the server default.
+// It reads the store, so it must not be called from a store mutation.
+func (s *Server) leaseDuration(profile string) time.Duration {
+	eff, err := s.store.ResolvePolicy(profile)
+	if err != nil || eff.Policy.LeaseTTLSeconds <= 0 {
+		return s.leaseTTL
+	}
+	return time.Duration(eff.Policy.LeaseTTLSeconds) * time.Second
+}
+
+// requestGeneration returns the fencing generation carried by the request,
+// taken from the body value or the X-Fencing-Generation header. Zero means
+// none was sent.
+func requestGeneration(r *http.Request, body uint64) (uint64, error) {
+	raw := strings.TrimSpace(r.Header.Get(fencingHeader))
+	if raw == "" {
+		return body, nil
+	}
+	header, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an unsigned integer", fencingHeader)
+	}
+	if body != 0 && body != header {
+		return 0, fmt.Errorf("%s does not match the generation in the body", fencingHeader)
+	}
+	return header, nil
+}
+
+// checkFencing refuses a session operation whose generation is missing or
+// does not match the generation granted to the session. Sessions attached
+// before fencing existed carry no generation and are not checked.
+func checkFencing(session store.Session, generation uint64) error {
+	if session.Generation == 0 {
+		return nil
+	}
+	if generation == 0 {
+		return errMissingGeneration
+	}
+	if generation != session.Generation {
+		return errStaleGeneration
+	}
+	return nil
+}
+
+// respondFencingError writes the response for a fencing failure and reports
+// whether err was one.
+func respondFencingError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, errMissingGeneration):
+		respondError(w, http.StatusPreconditionRequired, "missing_generation", "fencing generation is required")
+	case errors.Is(err, errStaleGeneration):
+		respondError(w, http.StatusConflict, "stale_generation", "fencing generation is stale; the session has been superseded")
+	default:
+		return false
+	}
+	return true
+}
+
+type heartbeatRequest struct {
+	// UsedBytes, when set, updates the volume's reported usage.
+	UsedBytes *int64 `json:"used_bytes,omitempty"`
+}
+
+// handleHeartbeat renews the lease of one of the volume's sessions.
+func (s *Server) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	sessionID := chi.URLParam(r, "sessionID")
+	var req heartbeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	if req.UsedBytes != nil && *req.UsedBytes < 0 {
+		respondError(w, http.StatusBadRequest, "invalid_usage", "used_bytes must not be negative")
+		return
+	}
+	_, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+	generation, err := requestGeneration(r, 0)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_generation", err.Error())
+		return
+	}
+
+	// Resolve the lease before UpdateVolume: the store lock is held while
+	// the mutation runs.
+	vol, err := s.store.GetVolume(id)
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+	lease := s.leaseDuration(vol.PolicyProfile)
+
+	var renewed store.Session
+	_, err = s.store.UpdateVolume(id, func(v *store.Volume) error {
+		if !s.authorized(r.Context(), *v, store.VerbRead) {
+			return errPrincipalMismatch
+		}
+		sessions := append([]store.Session{}, v.AttachSessions...)
+		for i := range sessions {
+			if sessions[i].SessionID != sessionID {
+				continue
+			}
+			if !s.holdsSession(r.Context(), *v, sessions[i]) {
+				return errPrincipalMismatch
+			}
+			if err := checkFencing(sessions[i], generation); err != nil {
+				return err
+			}
+			now := s.now()
+			if sessions[i].Expired(now) {
+				return errLeaseExpired
+			}
+			sessions[i].LeaseExpiresAt = now.Add(lease)
+			renewed = sessions[i]
+			v.AttachSessions = sessions
+			if req.UsedBytes != nil {
+				v.UsedBytes = *req.UsedBytes
+			}
+			return nil
+		}
+		return errSessionNotFound
+	})
+	if respondFencingError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, errPrincipalMismatch):
+		respondError(w, http.StatusForbidden, "principal_mismatch", "principal not authorised for this volume")
+		return
+	case errors.Is(err, errSessionNotFound):
+		respondError(w, http.StatusNotFound, "session_not_found", "session is not attached to this volume")
+		return
+	case errors.Is(err, errLeaseExpired):
+		respondError(w, http.StatusGone, "lease_expired", "session lease has expired")
+		return
+	case err != nil:
+		respondVolumeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, renewed)
+}
+
+// runReaper expires lapsed sessions and ephemeral volumes, and prunes old
+// idempotency records, until Close is called.
+func (s *Server) runReaper() {
+	defer close(s.reaperDone)
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.reaperStop:
+			return
+		case <-ticker.C:
+			s.reapExpiredSessions()
+			s.reapEphemeralVolumes()
+			s.pruneIdempotency()
+			s.pruneRevokedTokens()
+		}
+	}
+}
+
+// reapExpiredSessions detaches every session whose lease has lapsed and
+// returns how many were removed. Frozen volumes are left for a later pass.
+func (s *Server) reapExpiredSessions() int {
+	reaped := 0
+	for _, vol := range s.store.ListVolumes() {
+		if vol.AttachState != lifecycle.Attached || len(expiredSessions(vol, s.now())) == 0 {
+			continue
+		}
+		reaped += s.reapSessions(vol.VolumeID)
+	}
+	return reaped
+}
+
+func (s *Server) reapSessions(volumeID string) int {
+	release, ok := s.freezer.beginWrite(volumeID)
+	if !ok {
+		return 0
+	}
+	defer release()
+
+	var expired []store.Session
+	persisted, err := s.teardownSessions(volumeID, notify.EventSessionExpired, "lease expired", reaperPrincipal, func(v store.Volume) ([]store.Session, error) {
+		// A heartbeat may have renewed a lease since the volume was listed.
+		expired = expiredSessions(v, s.now())
+		if len(expired) == 0 {
+			return nil, errLeaseActive
+		}
+		return expired, nil
+	})
+	if err != nil {
+		if !errors.Is(err, errLeaseActive) && !errors.Is(err, lifecycle.ErrIllegalTransition) {
+			log.Printf("lease reaper: volume %s: %v", volumeID, err)
+		}
+		return 0
+	}
+	for _, session := range expired {
+		log.Printf("lease reaper: expired session %s on volume %s", session.SessionID, volumeID)
+	}
+	if _, err := s.discardEphemeral(persisted, reaperPrincipal); err != nil {
+		log.Printf("lease reaper: volume %s: %v", volumeID, err)
+	}
+	return len(expired)
+}
+
+// checkDataPathFencing refuses a data-path call on an attached volume unless
+// it carries the generation of a live session. A generation no live session
+// holds is stale even once the volume is detached; calls without one are
+// only refused while fenced sessions exist.
+func checkDataPathFencing(v store.Volume, generation uint64, now time.Time) error {
+	fenced := false
+	for _, session := range v.AttachSessions {
+		if session.Generation == 0 {
+			continue
+		}
+		fenced = true
+		if session.Generation == generation && !session.Expired(now) {
+			return nil
+		}
+	}
+	switch {
+	case generation != 0:
+		return errStaleGeneration
+	case fenced:
+		return errMissingGeneration
+	}
+	return nil
+}
+
+func expiredSessions(v store.Volume, now time.Time) []store.Session {
+	var expired []store.Session
+	for _, session := range v.AttachSessions {
+		if session.Expired(now) {
+			expired = append(expired, session)
+		}
+	}
+	return expired
+}
+
+// sessionListing is an attach session together with the volume it holds.
+type sessionListing struct {
+	VolumeID       string `json:"volume_id"`
+	OwnerPrincipal string `json:"owner_principal"`
+	store.Session
+}
+
+// handleListSessions lists attach sessions on every volume the caller may
+// read, optionally filtered by ?owner= and ?principal=.
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	_, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+
+	query := r.URL.Query()
+	owner, holder := query.Get("owner"), query.Get("principal")
+	sessions := make([]sessionListing, 0)
+	for _, v := range s.store.ListVolumes() {
+		if !s.authorized(r.Context(), v, store.VerbRead) {
+			continue
+		}
+		if owner != "" && v.OwnerPrincipal != owner {
+			continue
+		}
+		for _, session := range v.AttachSessions {
+			if holder != "" && session.Principal != holder {
+				continue
+			}
+			sessions = append(sessions, sessionListing{
+				VolumeID:       v.VolumeID,
+				OwnerPrincipal: v.OwnerPrincipal,
+				Session:        session,
+			})
+		}
+	}
+	respondJSON(w, http.StatusOK, sessions)
+}
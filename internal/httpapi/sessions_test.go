@@ -0,0 +1,82 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+)
+
+func TestHeartbeatRenewsLease(t *testing.T) {
+	clock := newFakeClock()
+	s, st := newTestServer(t, nil, WithClock(clock.Now))
+	h := s.Router()
+	vol := createVolume(t, h, "svc")
+	session := attach(t, h, vol.VolumeID, "svc", "s1")
+
+	expectStatus(t, heartbeat(t, h, vol.VolumeID, "s1", session.Generation), http.StatusOK)
+
+	// The store must still be usable after the heartbeat.
+	if _, err := st.GetVolume(vol.VolumeID); err != nil {
+		t.Fatalf("get volume: %v", err)
+	}
+}
+
+func TestHeartbeatExtendsLease(t *testing.T) {
+	clock := newFakeClock()
+	s, st := newTestServer(t, nil, WithClock(clock.Now), WithLeaseTTL(time.Minute))
+	h := s.Router()
+	vol := createVolume(t, h, "svc")
+	session := attach(t, h, vol.VolumeID, "svc", "s1")
+	if want := clock.Now().Add(time.Minute); !session.LeaseExpiresAt.Equal(want) {
+		t.Fatalf("lease expires at %v, want %v", session.LeaseExpiresAt, want)
+	}
+
+	clock.Advance(45 * time.Second)
+	rec := heartbeat(t, h, vol.VolumeID, "s1", session.Generation)
+	expectStatus(t, rec, http.StatusOK)
+	renewed := decodeBody[store.Session](t, rec)
+	if want := clock.Now().Add(time.Minute); !renewed.LeaseExpiresAt.Equal(want) {
+		t.Fatalf("renewed lease expires at %v, want %v", renewed.LeaseExpiresAt, want)
+	}
+
+	// Past the original lease but within the renewed one.
+	clock.Advance(45 * time.Second)
+	s.reapExpiredSessions()
+	got, err := st.GetVolume(vol.VolumeID)
+	if err != nil {
+		t.Fatalf("get volume: %v", err)
+	}
+	if _, ok := got.Session("s1"); !ok {
+		t.Fatal("renewed session was reaped")
+	}
+}
+
+func TestReaperExpiresLapsedSession(t *testing.T) {
+	clock := newFakeClock()
+	s, st := newTestServer(t, nil, WithClock(clock.Now), WithLeaseTTL(time.Minute))
+	h := s.Router()
+	vol := createVolume(t, h, "svc")
+	session := attach(t, h, vol.VolumeID, "svc", "s1")
+
+	clock.Advance(30 * time.Second)
+	s.reapExpiredSessions()
+	if got, _ := st.GetVolume(vol.VolumeID); len(got.AttachSessions) != 1 {
+		t.Fatalf("live session reaped: %+v", got.AttachSessions)
+	}
+
+	clock.Advance(31 * time.Second)
+	expectStatus(t, heartbeat(t, h, vol.VolumeID, "s1", session.Generation), http.StatusGone)
+
+	s.reapExpiredSessions()
+	got, err := st.GetVolume(vol.VolumeID)
+	if err != nil {
+		t.Fatalf("get volume: %v", err)
+	}
+	if len(got.AttachSessions) != 0 || got.AttachState != lifecycle.Available {
+		t.Fatalf("after reaping: state %s, sessions %+v", got.AttachState, got.AttachSessions)
+	}
+	expectStatus(t, heartbeat(t, h, vol.VolumeID, "s1", session.Generation), http.StatusNotFound)
+}
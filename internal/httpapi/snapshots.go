@@ -0,0 +1,131 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/ids"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type createSnapshotRequest struct {
+	Note string `json:"note,omitempty"`
+	// Generation, or the X-Fencing-Generation header, is required while the
+	// volume is attached and must belong to a live session.
+	Generation uint64 `json:"generation,omitempty"`
+	// IncludeEphemeral allows snapshotting an ephemeral volume.
+	IncludeEphemeral bool              `json:"include_ephemeral,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Annotations      map[string]string `json:"annotations,omitempty"`
+}
+
+func (s *Server) handleCreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	volumeID := chi.URLParam(r, "volumeID")
+	principal, vol, ok := s.authorizeVolume(w, r, volumeID, store.VerbSnapshot)
+	if !ok {
+		return
+	}
+
+	var req createSnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	if !validateMetadata(w, req.Labels, req.Annotations) {
+		return
+	}
+	generation, err := requestGeneration(r, req.Generation)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_generation", err.Error())
+		return
+	}
+	if respondFencingError(w, checkDataPathFencing(vol, generation, s.now())) {
+		return
+	}
+	if vol.Ephemeral() && !req.IncludeEphemeral {
+		respondEphemeralExcluded(w, volumeID)
+		return
+	}
+
+	snapshotID := ids.New(ids.Snapshot)
+	if preferAsync(r) {
+		op, err := s.startOperation(operationKindSnapshot, volumeID, principal, 1, nil,
+			func(ctx context.Context, t *operationTracker) (interface{}, error) {
+				if ctx.Err() != nil {
+					return nil, context.Cause(ctx)
+				}
+				release, ok := s.freezer.beginWrite(volumeID)
+				if !ok {
+					return nil, errors.New("volume is frozen by a consistency group capture")
+				}
+				defer release()
+				snap, err := s.store.AddSnapshot(volumeID, store.Snapshot{
+					SnapshotID:  snapshotID,
+					VolumeID:    volumeID,
+					CreatedAt:   time.Now().UTC(),
+					Note:        req.Note,
+					Labels:      req.Labels,
+					Annotations: req.Annotations,
+				})
+				if err != nil {
+					return nil, err
+				}
+				t.advance()
+				return snap, nil
+			})
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+			return
+		}
+		respondOperation(w, op)
+		return
+	}
+
+	release, ok := s.freezer.beginWrite(volumeID)
+	if !ok {
+		respondVolumeFrozen(w)
+		return
+	}
+	defer release()
+
+	snapshot := store.Snapshot{
+		SnapshotID:  snapshotID,
+		VolumeID:    volumeID,
+		CreatedAt:   time.Now().UTC(),
+		Note:        req.Note,
+		Labels:      req.Labels,
+		Annotations: req.Annotations,
+	}
+	persisted, err := s.store.AddSnapshot(volumeID, snapshot)
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, persisted)
+}
+
+func (s *Server) handleListSnapshots(w http.ResponseWriter, r *http.Request) {
+	volumeID := chi.URLParam(r, "volumeID")
+	_, _, ok := s.authorizeVolume(w, r, volumeID, store.VerbRead)
+	if !ok {
+		return
+	}
+
+	sel, ok := requestSelector(w, r)
+	if !ok {
+		return
+	}
+	snaps := make([]store.Snapshot, 0)
+	for _, snap := range s.store.ListSnapshots(volumeID) {
+		if sel.Matches(snap.Labels) {
+			snaps = append(snaps, snap)
+		}
+	}
+	respondJSON(w, http.StatusOK, snaps)
+}
@@ -0,0 +1,186 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/auth"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	auditActionTokenMint   = "auth.token-mint"
+	auditActionTokenRevoke = "auth.token-revoke"
+
+	defaultTokenTTL = 15 * time.Minute
+	// maxTokenTTL bounds minted tokens. Deny-list entries are kept this long
+	// so they outlive any token they revoke.
+	maxTokenTTL = time.Hour
+)
+
+type mintTokenRequest struct {
+	Principal  string   `json:"principal"`
+	Scopes     []string `json:"scopes"`
+	VolumeIDs  []string `json:"volume_ids,omitempty"`
+	TTLSeconds int64    `json:"ttl_seconds,omitempty"`
+}
+
+type mintTokenResponse struct {
+	Token     string    `json:"token"`
+	TokenID   string    `json:"token_id"`
+	Principal string    `json:"principal"`
+	Scopes    []string  `json:"scopes"`
+	VolumeIDs []string  `json:"volume_ids,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type whoamiResponse struct {
+	auth.Identity
+	// ClientCertificate is the subject of the verified mTLS client
+	// certificate, if any.
+	ClientCertificate string `json:"client_certificate,omitempty"`
+}
+
+// minter returns the common name of the request's verified client
+// certificate when it is allowed to mint tokens, writing an error response
+// otherwise.
+func (s *Server) minter(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if s.issuer == nil {
+		respondError(w, http.StatusNotFound, "minting_disabled", "token minting is not enabled")
+		return "", false
+	}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		respondError(w, http.StatusUnauthorized, "client_certificate_required", "a verified client certificate is required")
+		return "", false
+	}
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if _, ok := s.minters[name]; !ok {
+		respondError(w, http.StatusForbidden, "minter_required", fmt.Sprintf("client certificate %q may not mint tokens", name))
+		return "", false
+	}
+	return name, true
+}
+
+// handleMintToken issues a short-lived token restricted to the requested
+// scopes and, optionally, volumes. Minters authenticate with their client
+// certificate, not a bearer token.
+func (s *Server) handleMintToken(w http.ResponseWriter, r *http.Request) {
+	minter, ok := s.minter(w, r)
+	if !ok {
+		return
+	}
+	var req mintTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	req.Principal = strings.TrimSpace(req.Principal)
+	if req.Principal == "" {
+		respondError(w, http.StatusBadRequest, "missing_principal", "principal is required")
+		return
+	}
+	if _, ok := s.admins[req.Principal]; ok {
+		respondError(w, http.StatusForbidden, "admin_principal", "tokens cannot be minted for admin principals")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		respondError(w, http.StatusBadRequest, "invalid_scope", "at least one scope is required")
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !store.KnownVerb(scope) {
+			respondError(w, http.StatusBadRequest, "invalid_scope", fmt.Sprintf("unknown scope %q", scope))
+			return
+		}
+	}
+	req.VolumeIDs = dedupe(req.VolumeIDs)
+	for _, id := range req.VolumeIDs {
+		if _, err := s.store.GetVolume(id); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_volume", fmt.Sprintf("unknown volume %s", id))
+			return
+		}
+	}
+	ttl := defaultTokenTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+		if req.TTLSeconds < 0 || ttl > maxTokenTTL {
+			respondError(w, http.StatusBadRequest, "invalid_ttl", fmt.Sprintf("ttl_seconds must be between 1 and %d", int64(maxTokenTTL.Seconds())))
+			return
+		}
+	}
+
+	minted, err := s.issuer.Mint(auth.MintRequest{
+		Principal: req.Principal,
+		Scopes:    req.Scopes,
+		Volumes:   req.VolumeIDs,
+		TTL:       ttl,
+	}, s.now())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "mint_failed", err.Error())
+		return
+	}
+	details := map[string]interface{}{
+		"principal":  req.Principal,
+		"scopes":     req.Scopes,
+		"expires_at": minted.ExpiresAt,
+	}
+	if len(req.VolumeIDs) > 0 {
+		details["volume_ids"] = req.VolumeIDs
+	}
+	s.recordAudit("cert:"+minter, auditActionTokenMint, minted.TokenID, details)
+	respondJSON(w, http.StatusCreated, mintTokenResponse{
+		Token:     minted.Token,
+		TokenID:   minted.TokenID,
+		Principal: req.Principal,
+		Scopes:    req.Scopes,
+		VolumeIDs: req.VolumeIDs,
+		ExpiresAt: minted.ExpiresAt,
+	})
+}
+
+// handleRevokeToken adds a minted token to the deny list.
+func (s *Server) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	minter, ok := s.minter(w, r)
+	if !ok {
+		return
+	}
+	tokenID := chi.URLParam(r, "tokenID")
+	if err := s.store.RevokeToken(tokenID, s.now().Add(maxTokenTTL)); err != nil {
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+	s.recordAudit("cert:"+minter, auditActionTokenRevoke, tokenID, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleWhoami reports the identity the request authenticated as. Without
+// token auth every caller is an anonymous admin.
+func (s *Server) handleWhoami(w http.ResponseWriter, r *http.Request) {
+	var resp whoamiResponse
+	if !s.authEnabled() {
+		resp.Role = auth.RoleAdmin
+	} else {
+		id, ok := identityFromContext(r.Context())
+		if !ok {
+			respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+			return
+		}
+		resp.Identity = id
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		resp.ClientCertificate = r.TLS.VerifiedChains[0][0].Subject.String()
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// pruneRevokedTokens drops deny-list entries for tokens that have expired.
+func (s *Server) pruneRevokedTokens() {
+	if _, err := s.store.PruneRevokedTokens(s.now()); err != nil {
+		log.Printf("tokens: pruning deny list: %v", err)
+	}
+}
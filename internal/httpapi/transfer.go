@@ -0,0 +1,237 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	auditActionTransferRequest = "volume.transfer-request"
+	auditActionTransfer        = "volume.transfer"
+	auditActionTransferCancel  = "volume.transfer-cancel"
+)
+
+var (
+	errTransferAttached = errors.New("volume is attached")
+	errNoTransfer       = errors.New("no transfer pending")
+)
+
+type transferRequest struct {
+	ToPrincipal string `json:"to_principal"`
+	// Force completes the transfer immediately. Admins only.
+	Force bool `json:"force,omitempty"`
+}
+
+// handleTransferVolume offers the volume to another principal, who takes
+// ownership by accepting. Admins may force the transfer through at once.
+// Either way the volume must be detached.
+func (s *Server) handleTransferVolume(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	var req transferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	req.ToPrincipal = strings.TrimSpace(req.ToPrincipal)
+	if req.ToPrincipal == "" {
+		respondError(w, http.StatusBadRequest, "missing_principal", "to_principal is required")
+		return
+	}
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+	if req.Force && !s.isAdmin(r.Context()) {
+		respondError(w, http.StatusForbidden, "admin_required", "forced transfer requires an admin principal")
+		return
+	}
+	vol, err := s.store.GetVolume(id)
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+	if !req.Force && !s.authorized(r.Context(), vol, store.VerbManage) {
+		respondForbidden(w, store.VerbManage)
+		return
+	}
+	if req.ToPrincipal == vol.OwnerPrincipal {
+		respondError(w, http.StatusBadRequest, "invalid_principal", "to_principal already owns the volume")
+		return
+	}
+
+	release, ok := s.freezer.beginWrite(id)
+	if !ok {
+		respondVolumeFrozen(w)
+		return
+	}
+	defer release()
+
+	if req.Force {
+		s.completeTransfer(w, id, req.ToPrincipal, principal, true)
+		return
+	}
+	var previous store.Volume
+	persisted, err := s.store.UpdateVolume(id, func(v *store.Volume) error {
+		previous = *v
+		if err := transferable(*v); err != nil {
+			return err
+		}
+		v.PendingTransfer = &store.Transfer{
+			ToPrincipal: req.ToPrincipal,
+			RequestedBy: principal,
+			RequestedAt: s.now().UTC(),
+		}
+		return nil
+	})
+	if err != nil {
+		respondTransferError(w, previous, err)
+		return
+	}
+	s.recordAudit(principal, auditActionTransferRequest, id, map[string]interface{}{
+		"from_principal": persisted.OwnerPrincipal,
+		"to_principal":   req.ToPrincipal,
+	})
+	respondJSON(w, http.StatusAccepted, persisted)
+}
+
+// handleAcceptTransfer completes a pending transfer on behalf of its target.
+func (s *Server) handleAcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+	vol, err := s.store.GetVolume(id)
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+	if vol.PendingTransfer == nil {
+		respondError(w, http.StatusConflict, "no_pending_transfer", "volume has no pending transfer")
+		return
+	}
+	if s.authEnabled() && vol.PendingTransfer.ToPrincipal != principal {
+		respondError(w, http.StatusForbidden, "principal_mismatch", "transfer is offered to another principal")
+		return
+	}
+	if !tokenAllows(r.Context(), vol, store.VerbManage) {
+		respondForbidden(w, store.VerbManage)
+		return
+	}
+
+	release, ok := s.freezer.beginWrite(id)
+	if !ok {
+		respondVolumeFrozen(w)
+		return
+	}
+	defer release()
+
+	s.completeTransfer(w, id, vol.PendingTransfer.ToPrincipal, principal, false)
+}
+
+// completeTransfer hands the volume to its new owner and writes the response.
+// The caller holds the volume's write gate.
+func (s *Server) completeTransfer(w http.ResponseWriter, id, to, principal string, forced bool) {
+	var previous store.Volume
+	persisted, moved, err := s.store.TransferVolume(id, to, func(v store.Volume) error {
+		previous = v
+		if err := transferable(v); err != nil {
+			return err
+		}
+		if !forced && (v.PendingTransfer == nil || v.PendingTransfer.ToPrincipal != to) {
+			return errNoTransfer
+		}
+		return nil
+	})
+	if err != nil {
+		respondTransferError(w, previous, err)
+		return
+	}
+	details := map[string]interface{}{
+		"from_principal": previous.OwnerPrincipal,
+		"to_principal":   to,
+	}
+	if len(moved) > 0 {
+		details["checkpoints"] = moved
+	}
+	if forced {
+		details["forced"] = true
+	}
+	s.recordAudit(principal, auditActionTransfer, id, details)
+	respondJSON(w, http.StatusOK, persisted)
+}
+
+// handleCancelTransfer withdraws a pending transfer. The owner may cancel it
+// and the target may decline it.
+func (s *Server) handleCancelTransfer(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+	var previous store.Volume
+	_, err := s.store.UpdateVolume(id, func(v *store.Volume) error {
+		previous = *v
+		if v.PendingTransfer == nil {
+			return errNoTransfer
+		}
+		target := principal == v.PendingTransfer.ToPrincipal && tokenAllows(r.Context(), *v, store.VerbManage)
+		if !target && !s.authorized(r.Context(), *v, store.VerbManage) && !s.isAdmin(r.Context()) {
+			return errPrincipalMismatch
+		}
+		v.PendingTransfer = nil
+		return nil
+	})
+	switch {
+	case errors.Is(err, errPrincipalMismatch):
+		respondError(w, http.StatusForbidden, "principal_mismatch", "principal not authorised for this volume")
+		return
+	case err != nil:
+		respondTransferError(w, previous, err)
+		return
+	}
+	s.recordAudit(principal, auditActionTransferCancel, id, map[string]interface{}{
+		"to_principal": previous.PendingTransfer.ToPrincipal,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// transferable refuses transfers while the volume is attached or changing
+// state.
+func transferable(v store.Volume) error {
+	switch v.AttachState {
+	case lifecycle.Available:
+		return nil
+	case lifecycle.Attached:
+		return errTransferAttached
+	default:
+		return errVolumeBusy
+	}
+}
+
+func respondTransferError(w http.ResponseWriter, previous store.Volume, err error) {
+	switch {
+	case errors.Is(err, errTransferAttached):
+		respondJSON(w, http.StatusLocked, attachConflictResponse{
+			Error:    "volume_attached",
+			Message:  "volume is attached; detach it before transferring ownership",
+			Sessions: previous.AttachSessions,
+		})
+	case errors.Is(err, errVolumeBusy):
+		respondError(w, http.StatusConflict, "invalid_state", fmt.Sprintf("volume is %s", previous.AttachState))
+	case errors.Is(err, errNoTransfer):
+		respondError(w, http.StatusConflict, "no_pending_transfer", "volume has no pending transfer")
+	default:
+		respondVolumeError(w, err)
+	}
+}
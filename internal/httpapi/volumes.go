@@ -0,0 +1,719 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/ids"
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+	"github.com/AtDexters-Lab/aionFS/internal/notify"
+	"github.com/AtDexters-Lab/aionFS/internal/policy"
+	"github.com/AtDexters-Lab/aionFS/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	operationKindProvision = "volume.provision"
+	operationKindSnapshot  = "volume.snapshot"
+)
+
+var (
+	// errSessionExists aborts an attach whose session is already attached.
+	errSessionExists = errors.New("session already attached")
+	// errAccessConflict aborts an attach the access mode does not admit.
+	errAccessConflict = errors.New("access mode conflict")
+)
+
+type createVolumeRequest struct {
+	// Name, when set, must be unique among the owner's volumes.
+	Name           string `json:"name,omitempty"`
+	OwnerPrincipal string `json:"owner_principal"`
+	Class          string `json:"class"`
+	QuotaBytes     int64  `json:"quota_bytes"`
+	PolicyProfile  string `json:"policy_profile"`
+	ExportMode     string `json:"export_mode"`
+	AccessMode     string `json:"access_mode"`
+	// TTLSeconds overrides the server's lifetime for ephemeral volumes.
+	TTLSeconds  int64             `json:"ttl_seconds,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+func (s *Server) handleCreateVolume(w http.ResponseWriter, r *http.Request) {
+	var req createVolumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	principal, havePrincipal := principalFromContext(r.Context())
+	if s.authEnabled() {
+		if !havePrincipal {
+			respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+			return
+		}
+	}
+
+	if req.OwnerPrincipal == "" {
+		if s.authEnabled() {
+			req.OwnerPrincipal = principal
+		} else {
+			respondError(w, http.StatusBadRequest, "missing_owner", "owner_principal is required")
+			return
+		}
+	} else if req.OwnerPrincipal != principal && !s.managesAll(r.Context()) {
+		respondError(w, http.StatusForbidden, "principal_mismatch", "owner must match token principal")
+		return
+	}
+	if tokenRestricted(r.Context()) {
+		respondError(w, http.StatusForbidden, "token_restricted", "token is limited to existing volumes")
+		return
+	}
+	if req.Name != "" && !store.ValidName(req.Name) {
+		respondError(w, http.StatusBadRequest, "invalid_name", "name must be at most 63 lowercase letters, digits and dashes")
+		return
+	}
+	if req.ExportMode == "" {
+		req.ExportMode = store.ExportFS
+	}
+	if req.Class == "" {
+		req.Class = store.ClassPersistent
+	}
+	if !store.ValidClass(req.Class) {
+		respondError(w, http.StatusBadRequest, "invalid_class", fmt.Sprintf("unsupported volume class %q", req.Class))
+		return
+	}
+	if req.TTLSeconds < 0 || (req.TTLSeconds > 0 && req.Class != store.ClassEphemeral) {
+		respondError(w, http.StatusBadRequest, "invalid_ttl", "ttl_seconds must be positive and is only accepted for ephemeral volumes")
+		return
+	}
+	if !validateMetadata(w, req.Labels, req.Annotations) {
+		return
+	}
+	if req.PolicyProfile == "" {
+		req.PolicyProfile = policy.DefaultProfile
+	}
+	eff, err := s.store.ResolvePolicy(req.PolicyProfile)
+	if err != nil {
+		respondPolicyError(w, err)
+		return
+	}
+	if !quotaAllowed(eff.Policy, req.QuotaBytes) {
+		respondQuotaExceedsPolicy(w, eff)
+		return
+	}
+	if req.AccessMode == "" {
+		req.AccessMode = store.AccessSingleWriter
+	}
+	if !store.ValidAccessMode(req.AccessMode) {
+		respondError(w, http.StatusBadRequest, "invalid_access_mode", fmt.Sprintf("unsupported access mode %q", req.AccessMode))
+		return
+	}
+	if s.respondNamedVolume(w, req) {
+		return
+	}
+
+	volumeID := ids.New(ids.Volume)
+
+	v := store.Volume{
+		VolumeID:         volumeID,
+		Name:             req.Name,
+		OwnerPrincipal:   req.OwnerPrincipal,
+		Class:            req.Class,
+		QuotaBytes:       req.QuotaBytes,
+		ProvisionedBytes: req.QuotaBytes,
+		PolicyProfile:    req.PolicyProfile,
+		ExportMode:       req.ExportMode,
+		AccessMode:       req.AccessMode,
+		Policy:           &eff.Policy,
+		Labels:           req.Labels,
+		Annotations:      req.Annotations,
+		ExpiresAt:        s.ephemeralExpiry(req.Class, time.Duration(req.TTLSeconds)*time.Second),
+		MountHandle:      newMountInfo(volumeID, req.ExportMode, lifecycle.Available),
+		AttachState:      lifecycle.Available,
+		Transitions:      []lifecycle.Transition{lifecycle.Initial(lifecycle.Available, "created", principal)},
+	}
+
+	if preferAsync(r) {
+		v.AttachState = lifecycle.Preparing
+		v.MountHandle.State = lifecycle.Preparing
+		v.Transitions = []lifecycle.Transition{lifecycle.Initial(lifecycle.Preparing, "created", principal)}
+		if _, err := s.store.PutVolume(v); err != nil {
+			if errors.Is(err, store.ErrNameTaken) && s.respondNamedVolume(w, req) {
+				return
+			}
+			respondVolumeError(w, err)
+			return
+		}
+		op, err := s.startOperation(operationKindProvision, volumeID, principal, 1, nil, s.provisionVolume(volumeID, principal))
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+			return
+		}
+		respondOperation(w, op)
+		return
+	}
+
+	persisted, err := s.store.PutVolume(v)
+	if err != nil {
+		if errors.Is(err, store.ErrNameTaken) && s.respondNamedVolume(w, req) {
+			return
+		}
+		respondVolumeError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, persisted)
+}
+
+// respondNamedVolume handles a create request whose name the owner already
+// uses. A retry with the same parameters gets the existing volume back;
+// anything else is a conflict. It reports whether a response was written.
+func (s *Server) respondNamedVolume(w http.ResponseWriter, req createVolumeRequest) bool {
+	if req.Name == "" {
+		return false
+	}
+	existing, err := s.store.GetVolumeByName(req.OwnerPrincipal, req.Name)
+	if err != nil {
+		return false
+	}
+	if !matchesCreateRequest(existing, req) {
+		respondError(w, http.StatusConflict, "name_conflict",
+			fmt.Sprintf("name %q is used by volume %s with different parameters", req.Name, existing.VolumeID))
+		return true
+	}
+	respondJSON(w, http.StatusOK, existing)
+	return true
+}
+
+// matchesCreateRequest reports whether v is what req, with defaults
+// applied, would have created.
+func matchesCreateRequest(v store.Volume, req createVolumeRequest) bool {
+	return v.Class == req.Class &&
+		v.QuotaBytes == req.QuotaBytes &&
+		v.PolicyProfile == req.PolicyProfile &&
+		v.ExportMode == req.ExportMode &&
+		v.AccessMode == req.AccessMode &&
+		maps.Equal(v.Labels, req.Labels) &&
+		maps.Equal(v.Annotations, req.Annotations)
+}
+
+// provisionVolume returns the worker that finishes preparing a volume created
+// asynchronously. A cancelled provision removes the volume again.
+func (s *Server) provisionVolume(volumeID, principal string) operationFunc {
+	return func(ctx context.Context, t *operationTracker) (interface{}, error) {
+		if ctx.Err() != nil {
+			if err := s.deleteVolume(volumeID, "provisioning cancelled", principal); err != nil {
+				return nil, err
+			}
+			return nil, context.Cause(ctx)
+		}
+		persisted, err := s.store.TransitionVolume(volumeID, lifecycle.Available, "provisioned", principal, nil)
+		if err != nil {
+			return nil, err
+		}
+		t.advance()
+		return persisted, nil
+	}
+}
+
+// newMountInfo returns the mount handle for a freshly created volume.
+// Read-only sessions get their own export beside the read-write one.
+func newMountInfo(volumeID, exportMode string, state lifecycle.State) store.MountInfo {
+	return store.MountInfo{
+		Mode:         exportMode,
+		HostPath:     path.Join("/run/aionfs/mounts", volumeID),
+		ReadOnlyPath: readOnlyMountPath(volumeID),
+		State:        state,
+	}
+}
+
+func readOnlyMountPath(volumeID string) string {
+	return path.Join("/run/aionfs/mounts-ro", volumeID)
+}
+
+// deleteVolume walks a volume through deleting to deleted.
+func (s *Server) deleteVolume(volumeID, reason, principal string) error {
+	if _, err := s.store.TransitionVolume(volumeID, lifecycle.Deleting, reason, principal, nil); err != nil {
+		return err
+	}
+	return s.store.DeleteVolume(volumeID)
+}
+
+// respondVolumeError maps errors from volume store calls to responses.
+// Illegal lifecycle transitions surface as 409.
+func respondVolumeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrVolumeNotFound):
+		respondError(w, http.StatusNotFound, "not_found", "volume not found")
+	case errors.Is(err, lifecycle.ErrIllegalTransition):
+		respondError(w, http.StatusConflict, "invalid_transition", err.Error())
+	case errors.Is(err, store.ErrNameTaken):
+		respondError(w, http.StatusConflict, "name_conflict", err.Error())
+	case errors.Is(err, store.ErrIDConflict):
+		respondError(w, http.StatusConflict, "id_conflict", err.Error())
+	case errors.Is(err, store.ErrPoolExhausted):
+		respondError(w, http.StatusInsufficientStorage, "pool_exhausted", err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+	}
+}
+
+func (s *Server) handleListVolumes(w http.ResponseWriter, r *http.Request) {
+	_, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+
+	sel, ok := requestSelector(w, r)
+	if !ok {
+		return
+	}
+
+	pg, ok := requestPage(w, r)
+	if !ok {
+		return
+	}
+
+	name, owner := r.URL.Query().Get("name"), r.URL.Query().Get("owner")
+
+	volumes := make([]store.Volume, 0)
+	for _, v := range s.store.SelectVolumes(sel) {
+		if !s.authorized(r.Context(), v, store.VerbRead) {
+			continue
+		}
+		if (name != "" && v.Name != name) || (owner != "" && v.OwnerPrincipal != owner) {
+			continue
+		}
+		if !pg.admits(v.VolumeID) {
+			continue
+		}
+		volumes = append(volumes, v)
+		if pg.full(len(volumes)) {
+			break
+		}
+	}
+	respondJSON(w, http.StatusOK, volumes)
+}
+
+// handleGetVolumeByName resolves a volume name for the calling principal.
+// Without token auth, or for principals that see every tenant, ?owner= picks
+// the owner; when omitted, the name must be unambiguous across owners.
+func (s *Server) handleGetVolumeByName(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+	owner := principal
+	if s.seesAll(r.Context()) {
+		owner = r.URL.Query().Get("owner")
+	}
+
+	var matches []store.Volume
+	if owner != "" {
+		if v, err := s.store.GetVolumeByName(owner, name); err == nil {
+			matches = append(matches, v)
+		}
+	} else {
+		matches = s.store.FindVolumesByName(name)
+	}
+	found := len(matches)
+	matches = slices.DeleteFunc(matches, func(v store.Volume) bool {
+		return !s.authorized(r.Context(), v, store.VerbRead)
+	})
+	switch len(matches) {
+	case 0:
+		if found > 0 {
+			respondForbidden(w, store.VerbRead)
+			return
+		}
+		respondError(w, http.StatusNotFound, "not_found", "volume not found")
+	case 1:
+		respondJSON(w, http.StatusOK, matches[0])
+	default:
+		respondError(w, http.StatusConflict, "ambiguous_name", "several owners use this name; pass ?owner=")
+	}
+}
+
+func (s *Server) handleGetVolume(w http.ResponseWriter, r *http.Request) {
+	_, v, ok := s.authorizeVolume(w, r, chi.URLParam(r, "volumeID"), store.VerbRead)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, v)
+}
+
+type attachRequest struct {
+	Principal        string `json:"principal"`
+	SessionID        string `json:"session_id"`
+	ConsumerEndpoint string `json:"consumer_endpoint"`
+	ReadOnly         bool   `json:"read_only"`
+}
+
+func (s *Server) handleAttachVolume(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	var req attachRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	principal, havePrincipal := principalFromContext(r.Context())
+	if s.authEnabled() && !havePrincipal {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+	vol, err := s.store.GetVolume(id)
+	if err != nil {
+		if errors.Is(err, store.ErrVolumeNotFound) {
+			respondError(w, http.StatusNotFound, "not_found", "volume not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "store_error", err.Error())
+		return
+	}
+	if req.Principal == "" {
+		if s.authEnabled() {
+			req.Principal = principal
+		} else {
+			respondError(w, http.StatusBadRequest, "missing_principal", "principal is required")
+			return
+		}
+	}
+	verb := store.VerbAttachReadWrite
+	if req.ReadOnly {
+		verb = store.VerbAttachReadOnly
+	}
+	// Both the caller and the principal the session is attached for need
+	// the grant.
+	if !s.authorized(r.Context(), vol, verb) || !vol.Allows(req.Principal, verb) {
+		respondForbidden(w, verb)
+		return
+	}
+	release, ok := s.freezer.beginWrite(id)
+	if !ok {
+		respondVolumeFrozen(w)
+		return
+	}
+	defer release()
+	if req.SessionID == "" {
+		req.SessionID = ids.New(ids.Session)
+	}
+
+	now := s.now()
+	session := store.Session{
+		SessionID:        req.SessionID,
+		Principal:        req.Principal,
+		ConsumerEndpoint: req.ConsumerEndpoint,
+		AttachedAt:       now,
+		LeaseExpiresAt:   now.Add(s.leaseDuration(vol.PolicyProfile)),
+		ReadOnly:         req.ReadOnly,
+		MountPath:        vol.MountHandle.HostPath,
+	}
+	if req.ReadOnly {
+		// Volumes created before read-only exports have no path recorded.
+		session.MountPath = vol.MountHandle.ReadOnlyPath
+		if session.MountPath == "" {
+			session.MountPath = readOnlyMountPath(id)
+		}
+	}
+	var existing store.Session
+	persisted, err := s.store.AttachVolume(id, "attached session "+req.SessionID, req.Principal, func(v *store.Volume) error {
+		if current, ok := v.Session(req.SessionID); ok {
+			existing = current
+			return errSessionExists
+		}
+		if err := admitSession(*v, req.ReadOnly); err != nil {
+			return err
+		}
+		v.FencingGeneration++
+		session.Generation = v.FencingGeneration
+		v.AttachSessions = append(v.AttachSessions, session)
+		return nil
+	})
+	if errors.Is(err, errSessionExists) {
+		// Re-attaching the same session is idempotent.
+		if existing.Principal == req.Principal && existing.ReadOnly == req.ReadOnly {
+			current, gerr := s.store.GetVolume(id)
+			if gerr != nil {
+				respondVolumeError(w, gerr)
+				return
+			}
+			respondJSON(w, http.StatusOK, current)
+			return
+		}
+		err = errAccessConflict
+	}
+	if errors.Is(err, errAccessConflict) {
+		current, _ := s.store.GetVolume(id)
+		respondJSON(w, http.StatusConflict, attachConflictResponse{
+			Error:    "already_attached",
+			Message:  fmt.Sprintf("volume access mode %s does not admit this session", current.AccessMode),
+			Sessions: current.AttachSessions,
+		})
+		return
+	}
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, persisted)
+}
+
+// admitSession checks a new session against the volume's access mode.
+func admitSession(v store.Volume, readOnly bool) error {
+	if len(v.AttachSessions) == 0 {
+		return nil
+	}
+	switch v.AccessMode {
+	case store.AccessManyWriters:
+		return nil
+	case store.AccessManyReaders:
+		if readOnly {
+			return nil
+		}
+		for _, session := range v.AttachSessions {
+			if !session.ReadOnly {
+				return errAccessConflict
+			}
+		}
+		return nil
+	default:
+		return errAccessConflict
+	}
+}
+
+// attachConflictResponse reports the sessions holding a volume.
+type attachConflictResponse struct {
+	Error    string          `json:"error"`
+	Message  string          `json:"message"`
+	Sessions []store.Session `json:"sessions"`
+}
+
+type detachRequest struct {
+	SessionID string `json:"session_id"`
+	// Generation may also be sent in the X-Fencing-Generation header.
+	Generation uint64 `json:"generation,omitempty"`
+}
+
+func (s *Server) handleDetachVolume(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	var req detachRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	if req.SessionID == "" {
+		respondError(w, http.StatusBadRequest, "missing_session", "session_id is required")
+		return
+	}
+	generation, err := requestGeneration(r, req.Generation)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_generation", err.Error())
+		return
+	}
+	principal, _, ok := s.authorizeVolume(w, r, id, store.VerbRead)
+	if !ok {
+		return
+	}
+
+	release, ok := s.freezer.beginWrite(id)
+	if !ok {
+		respondVolumeFrozen(w)
+		return
+	}
+	defer release()
+
+	persisted, _, err := s.store.DetachSessions(id, "detached session "+req.SessionID, principal, func(v store.Volume) ([]store.Session, error) {
+		session, ok := v.Session(req.SessionID)
+		if !ok {
+			return nil, errSessionNotFound
+		}
+		if !s.holdsSession(r.Context(), v, session) {
+			return nil, errPrincipalMismatch
+		}
+		if err := checkFencing(session, generation); err != nil {
+			return nil, err
+		}
+		return []store.Session{session}, nil
+	})
+	if respondFencingError(w, err) {
+		return
+	}
+	if errors.Is(err, errSessionNotFound) {
+		current, _ := s.store.GetVolume(id)
+		respondJSON(w, http.StatusConflict, attachConflictResponse{
+			Error:    "session_mismatch",
+			Message:  "session is not attached to this volume",
+			Sessions: current.AttachSessions,
+		})
+		return
+	}
+	if errors.Is(err, errPrincipalMismatch) {
+		respondError(w, http.StatusForbidden, "principal_mismatch", "principal does not hold this session")
+		return
+	}
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+	persisted, err = s.discardEphemeral(persisted, principal)
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, persisted)
+}
+
+type forceDetachRequest struct {
+	Reason string `json:"reason"`
+	// SessionID limits the teardown to one session; empty tears down all.
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// handleForceDetachVolume lets an admin tear down sessions holding the
+// volume. Each session's consumer endpoint is told about it.
+func (s *Server) handleForceDetachVolume(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	var req forceDetachRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "invalid_payload", "unable to decode request body")
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		respondError(w, http.StatusBadRequest, "missing_reason", "reason is required")
+		return
+	}
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+	if !s.isAdmin(r.Context()) {
+		respondError(w, http.StatusForbidden, "admin_required", "force detach requires an admin principal")
+		return
+	}
+
+	release, ok := s.freezer.beginWrite(id)
+	if !ok {
+		respondVolumeFrozen(w)
+		return
+	}
+	defer release()
+
+	persisted, err := s.teardownSessions(id, notify.EventSessionRevoked, "force detached: "+req.Reason, principal, func(v store.Volume) ([]store.Session, error) {
+		if req.SessionID == "" {
+			return v.AttachSessions, nil
+		}
+		session, ok := v.Session(req.SessionID)
+		if !ok {
+			return nil, errSessionNotFound
+		}
+		return []store.Session{session}, nil
+	})
+	if errors.Is(err, errSessionNotFound) {
+		respondError(w, http.StatusNotFound, "session_not_found", "session is not attached to this volume")
+		return
+	}
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+	persisted, err = s.discardEphemeral(persisted, principal)
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, persisted)
+}
+
+func (s *Server) handleDeleteVolume(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "volumeID")
+	force := r.URL.Query().Get("force") == "true"
+	principal, ok := principalFromContext(r.Context())
+	if s.authEnabled() && !ok {
+		respondError(w, http.StatusUnauthorized, "unauthorized", "token required")
+		return
+	}
+	if force && !s.isAdmin(r.Context()) {
+		respondError(w, http.StatusForbidden, "admin_required", "force delete requires an admin principal")
+		return
+	}
+
+	vol, err := s.store.GetVolume(id)
+	if err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+	if !force && !s.authorized(r.Context(), vol, store.VerbDelete) {
+		respondForbidden(w, store.VerbDelete)
+		return
+	}
+	if vol.AttachState == lifecycle.Attached && !force {
+		respondJSON(w, http.StatusLocked, attachConflictResponse{
+			Error:    "volume_attached",
+			Message:  "volume is attached; detach it first or force delete as an admin",
+			Sessions: vol.AttachSessions,
+		})
+		return
+	}
+
+	release, ok := s.freezer.beginWrite(id)
+	if !ok {
+		respondVolumeFrozen(w)
+		return
+	}
+	defer release()
+
+	if vol.AttachState == lifecycle.Attached {
+		if _, err := s.teardownSessions(id, notify.EventSessionRevoked, "session torn down by force delete", principal, func(v store.Volume) ([]store.Session, error) {
+			return v.AttachSessions, nil
+		}); err != nil {
+			respondVolumeError(w, err)
+			return
+		}
+	}
+	reason := "deleted via API"
+	if force {
+		reason = "force deleted via API"
+	}
+	if err := s.deleteVolume(id, reason, principal); err != nil {
+		respondVolumeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// teardownSessions detaches the sessions chosen by choose on behalf of someone
+// other than their holders and sends event to each consumer endpoint.
+func (s *Server) teardownSessions(volumeID, event, reason, principal string, choose func(store.Volume) ([]store.Session, error)) (store.Volume, error) {
+	persisted, removed, err := s.store.DetachSessions(volumeID, reason, principal, choose)
+	if err != nil {
+		return store.Volume{}, err
+	}
+	for _, session := range removed {
+		if session.ConsumerEndpoint == "" {
+			continue
+		}
+		s.notifier.Notify(session.ConsumerEndpoint, notify.Event{
+			Type:      event,
+			VolumeID:  volumeID,
+			SessionID: session.SessionID,
+			Actor:     principal,
+			Reason:    reason,
+			At:        s.now(),
+		})
+	}
+	return persisted, nil
+}
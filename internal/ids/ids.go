@@ -0,0 +1,140 @@
+// Package ids generates resource identifiers. An ID is a type prefix, a dash
+// and a 26-character lowercase Crockford base32 string holding a 48-bit
+// millisecond timestamp followed by 80 random bits, so IDs sort by creation
+// time. IDs minted in the same millisecond by one process stay in order.
+package ids
+
+import (
+	"crypto/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resource prefixes.
+const (
+	Volume     = "vol"
+	Snapshot   = "snap"
+	Session    = "sess"
+	Checkpoint = "chk"
+	Operation  = "op"
+	Event      = "evt"
+	Token      = "tok"
+)
+
+const (
+	alphabet      = "0123456789abcdefghjkmnpqrstvwxyz"
+	encodedLength = 26
+	// legacyLength is the length of the random part of IDs minted before
+	// this package: the first 8 hex characters of a UUID.
+	legacyLength = 8
+)
+
+var generator struct {
+	sync.Mutex
+	lastMillis uint64
+	last       [16]byte
+}
+
+// New returns a fresh ID with the given prefix.
+func New(prefix string) string {
+	return prefix + "-" + encode(next(time.Now()))
+}
+
+// next returns the 128-bit value for an ID minted at now. Within one
+// millisecond the random part is incremented rather than redrawn so IDs keep
+// their order.
+func next(now time.Time) [16]byte {
+	generator.Lock()
+	defer generator.Unlock()
+	millis := uint64(now.UnixMilli())
+	if millis <= generator.lastMillis && increment(generator.last[6:]) {
+		return generator.last
+	}
+	if millis <= generator.lastMillis {
+		// The random part overflowed; borrow the next millisecond.
+		millis = generator.lastMillis + 1
+	}
+	var b [16]byte
+	for i := 0; i < 6; i++ {
+		b[i] = byte(millis >> (40 - 8*i))
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic("ids: reading random bytes: " + err.Error())
+	}
+	generator.lastMillis = millis
+	generator.last = b
+	return b
+}
+
+// increment adds one to a big-endian number and reports false on overflow.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode writes 128 bits as 26 base32 characters, padding with two leading
+// zero bits.
+func encode(b [16]byte) string {
+	var out [encodedLength]byte
+	for i := 0; i < encodedLength; i++ {
+		var v byte
+		for bit := 0; bit < 5; bit++ {
+			pos := i*5 + bit - 2
+			v <<= 1
+			if pos >= 0 && b[pos/8]&(0x80>>(pos%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = alphabet[v]
+	}
+	return string(out[:])
+}
+
+// Time returns when an ID was minted. IDs in the legacy format carry no
+// timestamp and report false.
+func Time(id string) (time.Time, bool) {
+	_, body, ok := strings.Cut(id, "-")
+	if !ok || len(body) != encodedLength {
+		return time.Time{}, false
+	}
+	var millis uint64
+	for i := 0; i < 10; i++ {
+		idx := strings.IndexByte(alphabet, body[i])
+		if idx < 0 {
+			return time.Time{}, false
+		}
+		millis = millis<<5 | uint64(idx)
+	}
+	return time.UnixMilli(int64(millis)).UTC(), true
+}
+
+// IsLegacy reports whether id uses the short format of older releases: a
+// prefix and eight hex characters.
+func IsLegacy(id string) bool {
+	_, body, ok := strings.Cut(id, "-")
+	if !ok || len(body) != legacyLength {
+		return false
+	}
+	for _, r := range body {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Less orders IDs for listing and pagination. Legacy IDs have no creation
+// time and sort before every time-sortable ID.
+func Less(a, b string) bool {
+	la, lb := IsLegacy(a), IsLegacy(b)
+	if la != lb {
+		return la
+	}
+	return a < b
+}
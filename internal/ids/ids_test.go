@@ -0,0 +1,172 @@
+package ids
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolateGenerator starts the test from a fresh generator and restores the
+// shared state afterwards, so tests minting at made-up times neither see nor
+// leave behind a later millisecond.
+func isolateGenerator(t *testing.T) {
+	t.Helper()
+	generator.Lock()
+	saved := generator.lastMillis
+	savedLast := generator.last
+	generator.lastMillis = 0
+	generator.last = [16]byte{}
+	generator.Unlock()
+	t.Cleanup(func() {
+		generator.Lock()
+		defer generator.Unlock()
+		generator.lastMillis = saved
+		generator.last = savedLast
+	})
+}
+
+func TestNewFormat(t *testing.T) {
+	before := time.Now().Truncate(time.Millisecond)
+	id := New(Volume)
+	after := time.Now()
+
+	prefix, body, ok := strings.Cut(id, "-")
+	if !ok || prefix != Volume || len(body) != encodedLength {
+		t.Fatalf("New = %q, want vol- and %d characters", id, encodedLength)
+	}
+	for _, r := range body {
+		if !strings.ContainsRune(alphabet, r) {
+			t.Fatalf("New = %q uses %q outside the alphabet", id, r)
+		}
+	}
+	minted, ok := Time(id)
+	if !ok || minted.Before(before) || minted.After(after) {
+		t.Fatalf("Time(%q) = %v, %v; want between %v and %v", id, minted, ok, before, after)
+	}
+	if IsLegacy(id) {
+		t.Fatalf("IsLegacy(%q) = true", id)
+	}
+}
+
+// TestNextKeepsOrder checks that IDs minted within one millisecond, or by a
+// clock that steps back, still sort in minting order.
+func TestNextKeepsOrder(t *testing.T) {
+	isolateGenerator(t)
+	now := time.Now()
+	cases := []struct {
+		name  string
+		times []time.Time
+	}{
+		{"same millisecond", []time.Time{now, now, now, now}},
+		{"clock steps back", []time.Time{now, now.Add(-time.Second), now.Add(-time.Minute)}},
+		{"advancing", []time.Time{now, now.Add(time.Millisecond), now.Add(time.Second)}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var prev string
+			for _, at := range tc.times {
+				id := "vol-" + encode(next(at))
+				if prev != "" && !Less(prev, id) {
+					t.Fatalf("%s minted after %s sorts before it", id, prev)
+				}
+				prev = id
+			}
+		})
+	}
+}
+
+// TestNextBorrowsOnOverflow checks that exhausting the random part within a
+// millisecond moves on to the next millisecond instead of repeating an ID.
+func TestNextBorrowsOnOverflow(t *testing.T) {
+	isolateGenerator(t)
+	now := time.Now()
+	first := next(now)
+
+	generator.Lock()
+	for i := 6; i < 16; i++ {
+		generator.last[i] = 0xff
+	}
+	last := generator.last
+	generator.Unlock()
+
+	got := next(now)
+	if encode(got) <= encode(last) {
+		t.Fatalf("after overflow got %s, want it after %s", encode(got), encode(last))
+	}
+	ms, _ := Time("vol-" + encode(got))
+	was, _ := Time("vol-" + encode(first))
+	if !ms.After(was) {
+		t.Fatalf("after overflow minted at %v, want after %v", ms, was)
+	}
+}
+
+func TestIsLegacy(t *testing.T) {
+	cases := []struct {
+		id   string
+		want bool
+	}{
+		{"vol-4d3c9b1a", true},
+		{"snap-00000000", true},
+		{"vol-4d3c9b1", false},
+		{"vol-4d3c9b1a0", false},
+		{"vol-4D3C9B1A", false},
+		{"vol-4d3c9b1z", false},
+		{"4d3c9b1a", false},
+		{"", false},
+		{New(Volume), false},
+	}
+	for _, tc := range cases {
+		if got := IsLegacy(tc.id); got != tc.want {
+			t.Errorf("IsLegacy(%q) = %v, want %v", tc.id, got, tc.want)
+		}
+	}
+}
+
+func TestTimeRejectsOtherFormats(t *testing.T) {
+	for _, id := range []string{"", "vol", "vol-4d3c9b1a", "vol-" + strings.Repeat("u", encodedLength), "vol-" + strings.Repeat("0", encodedLength+1)} {
+		if at, ok := Time(id); ok {
+			t.Errorf("Time(%q) = %v, want no time", id, at)
+		}
+	}
+}
+
+func TestLess(t *testing.T) {
+	isolateGenerator(t)
+	early := "vol-" + encode(next(time.UnixMilli(1_700_000_000_000)))
+	late := "vol-" + encode(next(time.UnixMilli(1_800_000_000_000)))
+	cases := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"legacy before new", "vol-ffffffff", early, true},
+		{"new after legacy", early, "vol-00000000", false},
+		{"legacy by value", "vol-0000000a", "vol-0000000b", true},
+		{"legacy by value reversed", "vol-0000000b", "vol-0000000a", false},
+		{"new by time", early, late, true},
+		{"new by time reversed", late, early, false},
+		{"equal", early, early, false},
+		{"equal legacy", "vol-4d3c9b1a", "vol-4d3c9b1a", false},
+	}
+	for _, tc := range cases {
+		if got := Less(tc.a, tc.b); got != tc.want {
+			t.Errorf("%s: Less(%q, %q) = %v, want %v", tc.name, tc.a, tc.b, got, tc.want)
+		}
+	}
+
+	mixed := []string{late, "vol-ffffffff", early, "vol-00000001"}
+	slices.SortFunc(mixed, func(a, b string) int {
+		switch {
+		case Less(a, b):
+			return -1
+		case Less(b, a):
+			return 1
+		}
+		return 0
+	})
+	want := []string{"vol-00000001", "vol-ffffffff", early, late}
+	if !slices.Equal(mixed, want) {
+		t.Fatalf("sorted = %v, want %v", mixed, want)
+	}
+}
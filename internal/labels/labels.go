@@ -0,0 +1,120 @@
+// Package labels validates resource labels and annotations and evaluates
+// Kubernetes-style label selectors against them.
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	maxNameLength       = 63
+	maxPrefixLength     = 253
+	maxValueLength      = 63
+	maxAnnotationsBytes = 256 << 10
+)
+
+var (
+	// ErrInvalid is matched by every label or annotation validation failure.
+	ErrInvalid = errors.New("invalid labels or annotations")
+	// ErrInvalidSelector is returned for selectors that do not parse.
+	ErrInvalidSelector = errors.New("invalid label selector")
+)
+
+var (
+	namePattern   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	prefixPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// ValidateKey checks a label or annotation key: an optional DNS subdomain
+// prefix and slash followed by a name of at most 63 characters.
+func ValidateKey(key string) error {
+	name := key
+	if prefix, rest, ok := strings.Cut(key, "/"); ok {
+		if len(prefix) == 0 || len(prefix) > maxPrefixLength || !prefixPattern.MatchString(prefix) {
+			return fmt.Errorf("%w: key %q has an invalid prefix", ErrInvalid, key)
+		}
+		name = rest
+	}
+	if len(name) == 0 || len(name) > maxNameLength || !namePattern.MatchString(name) {
+		return fmt.Errorf("%w: key %q has an invalid name", ErrInvalid, key)
+	}
+	return nil
+}
+
+// ValidateValue checks a label value: empty, or at most 63 alphanumerics,
+// dashes, underscores and dots starting and ending with an alphanumeric.
+func ValidateValue(value string) error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > maxValueLength || !namePattern.MatchString(value) {
+		return fmt.Errorf("%w: value %q is invalid", ErrInvalid, value)
+	}
+	return nil
+}
+
+// Validate checks every key and value of a label set.
+func Validate(set map[string]string) error {
+	for _, key := range sortedKeys(set) {
+		if err := ValidateKey(key); err != nil {
+			return err
+		}
+		if err := ValidateValue(set[key]); err != nil {
+			return fmt.Errorf("label %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// ValidateAnnotations checks annotation keys and bounds their total size.
+// Values are free-form.
+func ValidateAnnotations(set map[string]string) error {
+	total := 0
+	for _, key := range sortedKeys(set) {
+		if err := ValidateKey(key); err != nil {
+			return err
+		}
+		total += len(key) + len(set[key])
+	}
+	if total > maxAnnotationsBytes {
+		return fmt.Errorf("%w: annotations exceed %d bytes", ErrInvalid, maxAnnotationsBytes)
+	}
+	return nil
+}
+
+// Patch updates a label or annotation set with JSON merge-patch semantics:
+// a value replaces the key and null removes it.
+type Patch map[string]*string
+
+// Apply returns base with the patch applied. base is not modified. An empty
+// result is nil.
+func (p Patch) Apply(base map[string]string) map[string]string {
+	out := make(map[string]string, len(base)+len(p))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(out, k)
+		} else {
+			out[k] = *v
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func sortedKeys(set map[string]string) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
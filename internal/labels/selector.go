@@ -0,0 +1,150 @@
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Operator is the comparison a selector requirement applies.
+type Operator string
+
+// Selector operators.
+const (
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is one comma-separated term of a selector.
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Selector matches label sets that satisfy every requirement. The empty
+// selector matches everything.
+type Selector []Requirement
+
+var setTerm = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\(([^()]*)\)$`)
+
+// Parse reads a selector such as "app=web,env!=prod,tier in (db,cache),!legacy".
+func Parse(raw string) (Selector, error) {
+	var sel Selector
+	for _, term := range splitTerms(raw) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return nil, fmt.Errorf("%w: empty requirement in %q", ErrInvalidSelector, raw)
+		}
+		req, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		if err := ValidateKey(req.Key); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+		}
+		for _, v := range req.Values {
+			if err := ValidateValue(v); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+			}
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	if m := setTerm.FindStringSubmatch(term); m != nil {
+		// An empty set would otherwise read as the single value "".
+		if strings.TrimSpace(m[3]) == "" {
+			return Requirement{}, fmt.Errorf("%w: %q needs at least one value", ErrInvalidSelector, term)
+		}
+		var values []string
+		for _, v := range strings.Split(m[3], ",") {
+			values = append(values, strings.TrimSpace(v))
+		}
+		return Requirement{Key: m[1], Operator: Operator(m[2]), Values: values}, nil
+	}
+	if strings.ContainsAny(term, "()") {
+		return Requirement{}, fmt.Errorf("%w: cannot parse %q", ErrInvalidSelector, term)
+	}
+	if key, value, ok := strings.Cut(term, "!="); ok {
+		return Requirement{Key: strings.TrimSpace(key), Operator: NotEquals, Values: []string{strings.TrimSpace(value)}}, nil
+	}
+	if key, value, ok := strings.Cut(term, "=="); ok {
+		return Requirement{Key: strings.TrimSpace(key), Operator: Equals, Values: []string{strings.TrimSpace(value)}}, nil
+	}
+	if key, value, ok := strings.Cut(term, "="); ok {
+		return Requirement{Key: strings.TrimSpace(key), Operator: Equals, Values: []string{strings.TrimSpace(value)}}, nil
+	}
+	if key, ok := strings.CutPrefix(term, "!"); ok {
+		return Requirement{Key: strings.TrimSpace(key), Operator: DoesNotExist}, nil
+	}
+	return Requirement{Key: term, Operator: Exists}, nil
+}
+
+// splitTerms splits raw on commas that are not inside a parenthesised set.
+func splitTerms(raw string) []string {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	var (
+		terms []string
+		depth int
+		start int
+	)
+	for i, r := range raw {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, raw[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, raw[start:])
+}
+
+// Matches reports whether set satisfies every requirement.
+func (s Selector) Matches(set map[string]string) bool {
+	for _, req := range s {
+		if !req.Matches(set) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether set satisfies the requirement. Negative operators
+// match sets that lack the key.
+func (r Requirement) Matches(set map[string]string) bool {
+	value, ok := set[r.Key]
+	switch r.Operator {
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	case Equals, In:
+		return ok && r.has(value)
+	case NotEquals, NotIn:
+		return !ok || !r.has(value)
+	}
+	return false
+}
+
+func (r Requirement) has(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package labels
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want Selector
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"app=web", Selector{{Key: "app", Operator: Equals, Values: []string{"web"}}}},
+		{"app==web", Selector{{Key: "app", Operator: Equals, Values: []string{"web"}}}},
+		{" app = web ", Selector{{Key: "app", Operator: Equals, Values: []string{"web"}}}},
+		{"app=", Selector{{Key: "app", Operator: Equals, Values: []string{""}}}},
+		{"env!=prod", Selector{{Key: "env", Operator: NotEquals, Values: []string{"prod"}}}},
+		{"tier in (db,cache)", Selector{{Key: "tier", Operator: In, Values: []string{"db", "cache"}}}},
+		{"tier in(db)", Selector{{Key: "tier", Operator: In, Values: []string{"db"}}}},
+		{"tier notin ( db , cache )", Selector{{Key: "tier", Operator: NotIn, Values: []string{"db", "cache"}}}},
+		{"legacy", Selector{{Key: "legacy", Operator: Exists}}},
+		{"!legacy", Selector{{Key: "legacy", Operator: DoesNotExist}}},
+		{"! legacy", Selector{{Key: "legacy", Operator: DoesNotExist}}},
+		{"example.com/team=core", Selector{{Key: "example.com/team", Operator: Equals, Values: []string{"core"}}}},
+		{"app=web,tier in (db,cache),!legacy,env!=prod", Selector{
+			{Key: "app", Operator: Equals, Values: []string{"web"}},
+			{Key: "tier", Operator: In, Values: []string{"db", "cache"}},
+			{Key: "legacy", Operator: DoesNotExist},
+			{Key: "env", Operator: NotEquals, Values: []string{"prod"}},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.raw, func(t *testing.T) {
+			got, err := Parse(tc.raw)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tc.raw, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Parse(%q) = %+v, want %+v", tc.raw, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	cases := []struct {
+		name string
+		raw  string
+	}{
+		{"empty term", "app=web,,env=prod"},
+		{"leading comma", ",app=web"},
+		{"trailing comma", "app=web,"},
+		{"blank term", "app=web, ,env=prod"},
+		{"empty set", "tier in ()"},
+		{"blank set", "tier notin ( )"},
+		{"nested parens", "tier in ((db))"},
+		{"set inside set", "tier in (db,(cache))"},
+		{"unclosed set", "tier in (db,cache"},
+		{"unopened set", "tier in db,cache)"},
+		{"stray parens", "app=(web)"},
+		{"missing key", "=web"},
+		{"bare bang", "!"},
+		{"bang with value", "!app=web"},
+		{"set without key", "in (db)"},
+		{"bad key", "bad key!=x"},
+		{"bad value", "app=not valid"},
+		{"bad set value", "tier in (db,not valid)"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if sel, err := Parse(tc.raw); !errors.Is(err, ErrInvalidSelector) {
+				t.Fatalf("Parse(%q) = %+v, %v; want ErrInvalidSelector", tc.raw, sel, err)
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	set := map[string]string{"app": "web", "tier": "db", "empty": ""}
+	cases := []struct {
+		raw  string
+		want bool
+	}{
+		{"", true},
+		{"app=web", true},
+		{"app=api", false},
+		{"app!=api", true},
+		{"missing!=x", true},
+		{"tier in (db,cache)", true},
+		{"tier in (cache)", false},
+		{"missing in (db)", false},
+		{"tier notin (cache)", true},
+		{"tier notin (db)", false},
+		{"missing notin (db)", true},
+		{"app", true},
+		{"missing", false},
+		{"!missing", true},
+		{"!app", false},
+		{"empty=", true},
+		{"empty", true},
+		{"app=web,tier=db", true},
+		{"app=web,tier=cache", false},
+	}
+	for _, tc := range cases {
+		sel, err := Parse(tc.raw)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.raw, err)
+		}
+		if got := sel.Matches(set); got != tc.want {
+			t.Errorf("%q matches %v = %v, want %v", tc.raw, set, got, tc.want)
+		}
+	}
+	// A nil label set lacks every key.
+	if sel, _ := Parse("!app,tier notin (db)"); !sel.Matches(nil) {
+		t.Errorf("negative selector does not match an unlabelled resource")
+	}
+}
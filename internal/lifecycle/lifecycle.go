@@ -0,0 +1,84 @@
+// Package lifecycle defines the volume state machine shared by the store and
+// the HTTP layer.
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// State is a volume lifecycle state. It doubles as the attach state and the
+// mount handle state reported to clients.
+type State string
+
+// Volume lifecycle states.
+const (
+	Preparing State = "preparing"
+	Available State = "available"
+	Attached  State = "attached"
+	Detaching State = "detaching"
+	Deleting  State = "deleting"
+	Deleted   State = "deleted"
+	Error     State = "error"
+)
+
+// transitions lists the states reachable from each state.
+var transitions = map[State][]State{
+	Preparing: {Available, Deleting, Error},
+	Available: {Attached, Deleting, Error},
+	Attached:  {Detaching, Error},
+	Detaching: {Available, Error},
+	Deleting:  {Deleted, Error},
+	Deleted:   {},
+	Error:     {Available, Deleting},
+}
+
+// ErrIllegalTransition is matched by every TransitionError.
+var ErrIllegalTransition = errors.New("illegal lifecycle transition")
+
+// TransitionError reports a transition the state machine does not allow.
+type TransitionError struct {
+	From State
+	To   State
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("volume cannot move from %s to %s", e.From, e.To)
+}
+
+// Is lets errors.Is match ErrIllegalTransition.
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// Transition records a single state change.
+type Transition struct {
+	From      State     `json:"from,omitempty"`
+	To        State     `json:"to"`
+	Reason    string    `json:"reason"`
+	Principal string    `json:"principal,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Valid reports whether s is a known state.
+func (s State) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// Check returns a *TransitionError unless the table allows from -> to.
+func Check(from, to State) error {
+	for _, next := range transitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return &TransitionError{From: from, To: to}
+}
+
+// Initial returns the transition recorded when a volume is first created in
+// state to.
+func Initial(to State, reason, principal string) Transition {
+	return Transition{To: to, Reason: reason, Principal: principal, At: time.Now().UTC()}
+}
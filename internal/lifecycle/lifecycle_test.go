@@ -0,0 +1,85 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+)
+
+var allStates = []State{Preparing, Available, Attached, Detaching, Deleting, Deleted, Error}
+
+func TestCheck(t *testing.T) {
+	// legal is written out rather than derived from transitions so a change
+	// to the table has to be made in both places.
+	legal := map[[2]State]bool{
+		{Preparing, Available}: true,
+		{Preparing, Deleting}:  true,
+		{Preparing, Error}:     true,
+		{Available, Attached}:  true,
+		{Available, Deleting}:  true,
+		{Available, Error}:     true,
+		{Attached, Detaching}:  true,
+		{Attached, Error}:      true,
+		{Detaching, Available}: true,
+		{Detaching, Error}:     true,
+		{Deleting, Deleted}:    true,
+		{Deleting, Error}:      true,
+		{Error, Available}:     true,
+		{Error, Deleting}:      true,
+	}
+	for _, from := range allStates {
+		for _, to := range allStates {
+			err := Check(from, to)
+			if legal[[2]State{from, to}] {
+				if err != nil {
+					t.Errorf("Check(%s, %s) = %v, want nil", from, to, err)
+				}
+				continue
+			}
+			var te *TransitionError
+			if !errors.As(err, &te) || te.From != from || te.To != to {
+				t.Errorf("Check(%s, %s) = %v, want a TransitionError", from, to, err)
+			}
+			if !errors.Is(err, ErrIllegalTransition) {
+				t.Errorf("Check(%s, %s) does not match ErrIllegalTransition", from, to)
+			}
+		}
+	}
+}
+
+func TestCheckUnknownState(t *testing.T) {
+	cases := []struct {
+		from, to State
+	}{
+		{"", Available},
+		{"bogus", Available},
+		{Available, "bogus"},
+	}
+	for _, tc := range cases {
+		if err := Check(tc.from, tc.to); !errors.Is(err, ErrIllegalTransition) {
+			t.Errorf("Check(%q, %q) = %v, want ErrIllegalTransition", tc.from, tc.to, err)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, s := range allStates {
+		if !s.Valid() {
+			t.Errorf("%s.Valid() = false", s)
+		}
+	}
+	for _, s := range []State{"", "bogus", "Available"} {
+		if s.Valid() {
+			t.Errorf("%q.Valid() = true", s)
+		}
+	}
+}
+
+func TestInitial(t *testing.T) {
+	tr := Initial(Available, "created", "svc")
+	if tr.From != "" || tr.To != Available || tr.Reason != "created" || tr.Principal != "svc" {
+		t.Fatalf("Initial = %+v", tr)
+	}
+	if tr.At.IsZero() || tr.At.Location().String() != "UTC" {
+		t.Fatalf("Initial.At = %v, want a UTC timestamp", tr.At)
+	}
+}
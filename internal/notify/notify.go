@@ -0,0 +1,97 @@
+// Package notify tells session consumers when the server tears their session
+// down on someone else's behalf.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	// EventSessionRevoked is sent when a session is detached by someone
+	// other than its holder.
+	EventSessionRevoked = "session.revoked"
+	// EventSessionExpired is sent when a session's lease lapses without a
+	// heartbeat.
+	EventSessionExpired = "session.expired"
+)
+
+// Event describes a change delivered to a consumer endpoint.
+type Event struct {
+	Type      string    `json:"type"`
+	VolumeID  string    `json:"volume_id"`
+	SessionID string    `json:"session_id"`
+	Actor     string    `json:"actor,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Notifier delivers events to consumer endpoints. Notify must not block the
+// caller on delivery.
+type Notifier interface {
+	Notify(endpoint string, ev Event)
+}
+
+// HTTPNotifier POSTs events as JSON to http and https consumer endpoints.
+// Other endpoint schemes (for example podman://) are logged and skipped.
+type HTTPNotifier struct {
+	client *http.Client
+	wg     sync.WaitGroup
+}
+
+// NewHTTPNotifier constructs a notifier whose deliveries time out after
+// timeout.
+func NewHTTPNotifier(timeout time.Duration) *HTTPNotifier {
+	return &HTTPNotifier{client: &http.Client{Timeout: timeout}}
+}
+
+// Notify implements Notifier. Delivery happens in the background.
+func (n *HTTPNotifier) Notify(endpoint string, ev Event) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		log.Printf("notify: %s for session %s not delivered: unsupported endpoint %q", ev.Type, ev.SessionID, endpoint)
+		return
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("notify: encode %s: %v", ev.Type, err)
+		return
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := n.post(endpoint, body); err != nil {
+			log.Printf("notify: %s for session %s: %v", ev.Type, ev.SessionID, err)
+		}
+	}()
+}
+
+// Wait blocks until in-flight deliveries finish.
+func (n *HTTPNotifier) Wait() {
+	n.wg.Wait()
+}
+
+func (n *HTTPNotifier) post(endpoint string, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
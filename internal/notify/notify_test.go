@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPNotifierDelivers(t *testing.T) {
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request = %s with %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("decode event: %v", err)
+		}
+		received <- ev
+	}))
+	defer srv.Close()
+
+	n := NewHTTPNotifier(time.Second)
+	want := Event{
+		Type:      EventSessionRevoked,
+		VolumeID:  "vol-1",
+		SessionID: "sess-1",
+		Actor:     "admin",
+		Reason:    "force detach",
+		At:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	n.Notify(srv.URL+"/hooks", want)
+	n.Wait()
+
+	select {
+	case got := <-received:
+		if got != want {
+			t.Fatalf("event = %+v, want %+v", got, want)
+		}
+	default:
+		t.Fatal("event was not delivered")
+	}
+}
+
+func TestHTTPNotifierSkipsUnsupportedEndpoints(t *testing.T) {
+	n := NewHTTPNotifier(time.Second)
+	for _, endpoint := range []string{"", "podman://container/app", "unix:///run/app.sock", "://bad"} {
+		n.Notify(endpoint, Event{Type: EventSessionExpired, SessionID: "sess-1"})
+	}
+	// Nothing was started, so there is nothing to wait for.
+	done := make(chan struct{})
+	go func() {
+		n.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked on an endpoint that should have been skipped")
+	}
+}
+
+// stall holds a request well past the notifier timeouts used here, but not
+// so long that closing the test server waits on it for ever.
+func stall(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(time.Second):
+	}
+}
+
+func TestHTTPNotifierPost(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr bool
+	}{
+		{"accepted", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusAccepted) }, false},
+		{"not modified", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotModified) }, true},
+		{"server error", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }, true},
+		{"timeout", stall, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+
+			n := NewHTTPNotifier(50 * time.Millisecond)
+			start := time.Now()
+			err := n.post(srv.URL, []byte(`{}`))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("post = %v, want error %v", err, tc.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Fatalf("post took %v despite the timeout", elapsed)
+			}
+		})
+	}
+}
+
+// TestHTTPNotifierDoesNotBlock checks that Notify returns while a slow
+// endpoint is still being called.
+func TestHTTPNotifierDoesNotBlock(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(stall))
+	defer srv.Close()
+
+	n := NewHTTPNotifier(100 * time.Millisecond)
+	start := time.Now()
+	n.Notify(srv.URL, Event{Type: EventSessionExpired, SessionID: "sess-1"})
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("Notify blocked for %v", elapsed)
+	}
+	n.Wait()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("delivery outlived its timeout: %v", elapsed)
+	}
+}
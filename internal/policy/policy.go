@@ -0,0 +1,190 @@
+// Package policy defines policy profiles and resolves the effective policy a
+// volume's profile asks for.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// DefaultProfile is used when a volume names no profile.
+const DefaultProfile = "standard"
+
+// maxDepth bounds the parent chain walked during resolution.
+const maxDepth = 16
+
+// SourceDefault marks values that no profile in the chain set.
+const SourceDefault = "default"
+
+var (
+	// ErrProfileNotFound is returned when a profile or one of its parents
+	// does not exist.
+	ErrProfileNotFound = errors.New("policy profile not found")
+	// ErrInvalidProfile is matched by every validation failure.
+	ErrInvalidProfile = errors.New("invalid policy profile")
+)
+
+var profileName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Settings holds the values a profile sets. Nil fields are inherited from the
+// parent profile.
+type Settings struct {
+	DataShards       *int    `json:"data_shards,omitempty"`
+	ParityShards     *int    `json:"parity_shards,omitempty"`
+	EncryptionMode   *string `json:"encryption_mode,omitempty"`
+	RetentionDays    *int    `json:"retention_days,omitempty"`
+	SnapshotSchedule *string `json:"snapshot_schedule,omitempty"`
+	CacheMode        *string `json:"cache_mode,omitempty"`
+	LeaseTTLSeconds  *int64  `json:"lease_ttl_seconds,omitempty"`
+	MaxQuotaBytes    *int64  `json:"max_quota_bytes,omitempty"`
+}
+
+// Profile is a named, optionally inherited set of policy settings.
+type Profile struct {
+	Name        string `json:"name"`
+	Parent      string `json:"parent,omitempty"`
+	Description string `json:"description,omitempty"`
+	Settings
+}
+
+// Policy is the resolved set of storage settings applied to a volume. Zero
+// LeaseTTLSeconds and MaxQuotaBytes mean the server default and no limit.
+type Policy struct {
+	DataShards       int    `json:"data_shards"`
+	ParityShards     int    `json:"parity_shards"`
+	EncryptionMode   string `json:"encryption_mode"`
+	RetentionDays    int    `json:"retention_days"`
+	SnapshotSchedule string `json:"snapshot_schedule"`
+	CacheMode        string `json:"cache_mode"`
+	LeaseTTLSeconds  int64  `json:"lease_ttl_seconds,omitempty"`
+	MaxQuotaBytes    int64  `json:"max_quota_bytes,omitempty"`
+}
+
+// Effective is a resolved policy together with the profile each value came
+// from, keyed by JSON field name.
+type Effective struct {
+	Profile string            `json:"profile"`
+	Policy  Policy            `json:"policy"`
+	Sources map[string]string `json:"sources"`
+}
+
+// Defaults apply to fields no profile in the chain sets.
+var Defaults = Policy{
+	DataShards:       8,
+	ParityShards:     4,
+	EncryptionMode:   "dual",
+	RetentionDays:    30,
+	SnapshotSchedule: "off",
+	CacheMode:        "off",
+}
+
+var (
+	encryptionModes   = map[string]bool{"none": true, "tpm": true, "passphrase": true, "dual": true}
+	cacheModes        = map[string]bool{"off": true, "read-through": true, "read-write": true}
+	snapshotSchedules = map[string]bool{"off": true, "@hourly": true, "@daily": true, "@weekly": true}
+)
+
+// Builtins are seeded into an empty store.
+func Builtins() []Profile {
+	readWrite := "read-write"
+	archiveParity := 8
+	return []Profile{
+		{Name: DefaultProfile, Description: "Default profile for new volumes"},
+		{Name: "performance", Parent: DefaultProfile, Description: "Standard redundancy with a read-write cache", Settings: Settings{CacheMode: &readWrite}},
+		{Name: "archive", Parent: DefaultProfile, Description: "Extra parity for long-lived data", Settings: Settings{ParityShards: &archiveParity}},
+	}
+}
+
+// Lookup finds a profile by name.
+type Lookup func(name string) (Profile, bool)
+
+// Resolve merges the named profile with its ancestors. The nearest profile
+// that sets a value wins; values nobody sets come from Defaults.
+func Resolve(name string, lookup Lookup) (Effective, error) {
+	eff := Effective{Profile: name, Sources: map[string]string{}}
+	var chain []Profile
+	seen := map[string]bool{}
+	for next := name; next != ""; {
+		if seen[next] || len(chain) == maxDepth {
+			return Effective{}, fmt.Errorf("%w: inheritance cycle at %q", ErrInvalidProfile, next)
+		}
+		seen[next] = true
+		p, ok := lookup(next)
+		if !ok {
+			return Effective{}, fmt.Errorf("%w: %q", ErrProfileNotFound, next)
+		}
+		chain = append(chain, p)
+		next = p.Parent
+	}
+
+	src := eff.Sources
+	eff.Policy = Policy{
+		DataShards:       pick(chain, "data_shards", func(s Settings) *int { return s.DataShards }, Defaults.DataShards, src),
+		ParityShards:     pick(chain, "parity_shards", func(s Settings) *int { return s.ParityShards }, Defaults.ParityShards, src),
+		EncryptionMode:   pick(chain, "encryption_mode", func(s Settings) *string { return s.EncryptionMode }, Defaults.EncryptionMode, src),
+		RetentionDays:    pick(chain, "retention_days", func(s Settings) *int { return s.RetentionDays }, Defaults.RetentionDays, src),
+		SnapshotSchedule: pick(chain, "snapshot_schedule", func(s Settings) *string { return s.SnapshotSchedule }, Defaults.SnapshotSchedule, src),
+		CacheMode:        pick(chain, "cache_mode", func(s Settings) *string { return s.CacheMode }, Defaults.CacheMode, src),
+		LeaseTTLSeconds:  pick(chain, "lease_ttl_seconds", func(s Settings) *int64 { return s.LeaseTTLSeconds }, Defaults.LeaseTTLSeconds, src),
+		MaxQuotaBytes:    pick(chain, "max_quota_bytes", func(s Settings) *int64 { return s.MaxQuotaBytes }, Defaults.MaxQuotaBytes, src),
+	}
+	return eff, nil
+}
+
+// pick returns the first value set along chain and records where it came
+// from in sources.
+func pick[T any](chain []Profile, field string, get func(Settings) *T, def T, sources map[string]string) T {
+	for _, p := range chain {
+		if v := get(p.Settings); v != nil {
+			sources[field] = p.Name
+			return *v
+		}
+	}
+	sources[field] = SourceDefault
+	return def
+}
+
+// Validate checks a profile's own fields. Parent existence and cycles are
+// checked by Resolve.
+func (p Profile) Validate() error {
+	if !profileName.MatchString(p.Name) {
+		return fmt.Errorf("%w: name must be lowercase letters, digits and dashes", ErrInvalidProfile)
+	}
+	if p.Parent == p.Name {
+		return fmt.Errorf("%w: profile cannot be its own parent", ErrInvalidProfile)
+	}
+	if p.DataShards != nil && *p.DataShards < 1 {
+		return fmt.Errorf("%w: data_shards must be at least 1", ErrInvalidProfile)
+	}
+	if p.ParityShards != nil && *p.ParityShards < 0 {
+		return fmt.Errorf("%w: parity_shards must not be negative", ErrInvalidProfile)
+	}
+	if p.EncryptionMode != nil && !encryptionModes[*p.EncryptionMode] {
+		return fmt.Errorf("%w: unsupported encryption_mode %q", ErrInvalidProfile, *p.EncryptionMode)
+	}
+	if p.RetentionDays != nil && *p.RetentionDays < 0 {
+		return fmt.Errorf("%w: retention_days must not be negative", ErrInvalidProfile)
+	}
+	if p.SnapshotSchedule != nil && !snapshotSchedules[*p.SnapshotSchedule] {
+		return fmt.Errorf("%w: unsupported snapshot_schedule %q", ErrInvalidProfile, *p.SnapshotSchedule)
+	}
+	if p.CacheMode != nil && !cacheModes[*p.CacheMode] {
+		return fmt.Errorf("%w: unsupported cache_mode %q", ErrInvalidProfile, *p.CacheMode)
+	}
+	if p.LeaseTTLSeconds != nil && *p.LeaseTTLSeconds < 1 {
+		return fmt.Errorf("%w: lease_ttl_seconds must be at least 1", ErrInvalidProfile)
+	}
+	if p.MaxQuotaBytes != nil && *p.MaxQuotaBytes < 1 {
+		return fmt.Errorf("%w: max_quota_bytes must be positive", ErrInvalidProfile)
+	}
+	return nil
+}
+
+// NeedsMigration reports whether moving a volume from one policy to another
+// requires rewriting its data. Other settings take effect in place.
+func NeedsMigration(from, to Policy) bool {
+	return from.DataShards != to.DataShards ||
+		from.ParityShards != to.ParityShards ||
+		from.EncryptionMode != to.EncryptionMode
+}
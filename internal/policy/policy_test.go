@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func lookupIn(profiles ...Profile) Lookup {
+	byName := make(map[string]Profile, len(profiles))
+	for _, p := range profiles {
+		byName[p.Name] = p
+	}
+	return func(name string) (Profile, bool) {
+		p, ok := byName[name]
+		return p, ok
+	}
+}
+
+func TestResolveOverrides(t *testing.T) {
+	lookup := lookupIn(append(Builtins(),
+		Profile{Name: "team", Parent: "archive", Settings: Settings{EncryptionMode: ptr("tpm"), MaxQuotaBytes: ptr(int64(1 << 30))}},
+		Profile{Name: "team-hot", Parent: "team", Settings: Settings{ParityShards: ptr(2), CacheMode: ptr("read-through")}},
+	)...)
+
+	cases := []struct {
+		profile string
+		want    Policy
+		sources map[string]string
+	}{
+		{
+			profile: DefaultProfile,
+			want:    Defaults,
+			sources: map[string]string{"data_shards": SourceDefault, "parity_shards": SourceDefault, "cache_mode": SourceDefault},
+		},
+		{
+			profile: "archive",
+			want:    Policy{DataShards: 8, ParityShards: 8, EncryptionMode: "dual", RetentionDays: 30, SnapshotSchedule: "off", CacheMode: "off"},
+			sources: map[string]string{"parity_shards": "archive", "encryption_mode": SourceDefault},
+		},
+		{
+			profile: "team",
+			want:    Policy{DataShards: 8, ParityShards: 8, EncryptionMode: "tpm", RetentionDays: 30, SnapshotSchedule: "off", CacheMode: "off", MaxQuotaBytes: 1 << 30},
+			sources: map[string]string{"parity_shards": "archive", "encryption_mode": "team", "max_quota_bytes": "team"},
+		},
+		{
+			// The nearest profile wins over an ancestor that sets the same field.
+			profile: "team-hot",
+			want:    Policy{DataShards: 8, ParityShards: 2, EncryptionMode: "tpm", RetentionDays: 30, SnapshotSchedule: "off", CacheMode: "read-through", MaxQuotaBytes: 1 << 30},
+			sources: map[string]string{"parity_shards": "team-hot", "encryption_mode": "team", "cache_mode": "team-hot", "retention_days": SourceDefault},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.profile, func(t *testing.T) {
+			eff, err := Resolve(tc.profile, lookup)
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if eff.Profile != tc.profile {
+				t.Fatalf("profile = %q, want %q", eff.Profile, tc.profile)
+			}
+			if eff.Policy != tc.want {
+				t.Fatalf("policy = %+v, want %+v", eff.Policy, tc.want)
+			}
+			if len(eff.Sources) != 8 {
+				t.Fatalf("sources = %v, want one per field", eff.Sources)
+			}
+			for field, want := range tc.sources {
+				if got := eff.Sources[field]; got != want {
+					t.Errorf("sources[%s] = %q, want %q", field, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveRejectsBrokenChains(t *testing.T) {
+	// A chain one longer than the walk allows.
+	long := make([]Profile, 0, maxDepth+1)
+	for i := 0; i <= maxDepth; i++ {
+		p := Profile{Name: fmt.Sprintf("p%d", i)}
+		if i < maxDepth {
+			p.Parent = fmt.Sprintf("p%d", i+1)
+		}
+		long = append(long, p)
+	}
+
+	cases := []struct {
+		name    string
+		profile string
+		lookup  Lookup
+		want    error
+	}{
+		{"self parent", "a", lookupIn(Profile{Name: "a", Parent: "a"}), ErrInvalidProfile},
+		{"two-profile cycle", "a", lookupIn(Profile{Name: "a", Parent: "b"}, Profile{Name: "b", Parent: "a"}), ErrInvalidProfile},
+		{"cycle above the profile", "leaf", lookupIn(
+			Profile{Name: "leaf", Parent: "a"},
+			Profile{Name: "a", Parent: "b"},
+			Profile{Name: "b", Parent: "c"},
+			Profile{Name: "c", Parent: "a"},
+		), ErrInvalidProfile},
+		{"too deep", "p0", lookupIn(long...), ErrInvalidProfile},
+		{"missing profile", "nope", lookupIn(), ErrProfileNotFound},
+		{"missing parent", "a", lookupIn(Profile{Name: "a", Parent: "gone"}), ErrProfileNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Resolve(tc.profile, tc.lookup); !errors.Is(err, tc.want) {
+				t.Fatalf("Resolve = %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	if _, err := Resolve("p1", lookupIn(long...)); err != nil {
+		t.Fatalf("chain of exactly %d profiles: %v", maxDepth, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		profile Profile
+		valid   bool
+	}{
+		{"minimal", Profile{Name: "team"}, true},
+		{"all settings", Profile{Name: "team", Parent: "standard", Settings: Settings{
+			DataShards:       ptr(4),
+			ParityShards:     ptr(0),
+			EncryptionMode:   ptr("none"),
+			RetentionDays:    ptr(0),
+			SnapshotSchedule: ptr("@daily"),
+			CacheMode:        ptr("read-write"),
+			LeaseTTLSeconds:  ptr(int64(30)),
+			MaxQuotaBytes:    ptr(int64(1)),
+		}}, true},
+		{"uppercase name", Profile{Name: "Team"}, false},
+		{"empty name", Profile{}, false},
+		{"own parent", Profile{Name: "team", Parent: "team"}, false},
+		{"no data shards", Profile{Name: "team", Settings: Settings{DataShards: ptr(0)}}, false},
+		{"negative parity", Profile{Name: "team", Settings: Settings{ParityShards: ptr(-1)}}, false},
+		{"unknown encryption", Profile{Name: "team", Settings: Settings{EncryptionMode: ptr("rot13")}}, false},
+		{"negative retention", Profile{Name: "team", Settings: Settings{RetentionDays: ptr(-1)}}, false},
+		{"unknown schedule", Profile{Name: "team", Settings: Settings{SnapshotSchedule: ptr("@minutely")}}, false},
+		{"unknown cache mode", Profile{Name: "team", Settings: Settings{CacheMode: ptr("write-back")}}, false},
+		{"zero lease", Profile{Name: "team", Settings: Settings{LeaseTTLSeconds: ptr(int64(0))}}, false},
+		{"zero quota limit", Profile{Name: "team", Settings: Settings{MaxQuotaBytes: ptr(int64(0))}}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.profile.Validate()
+			if tc.valid && err != nil {
+				t.Fatalf("Validate = %v, want nil", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidProfile) {
+				t.Fatalf("Validate = %v, want ErrInvalidProfile", err)
+			}
+		})
+	}
+}
+
+func TestNeedsMigration(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(*Policy)
+		want   bool
+	}{
+		{"unchanged", func(*Policy) {}, false},
+		{"data shards", func(p *Policy) { p.DataShards = 6 }, true},
+		{"parity shards", func(p *Policy) { p.ParityShards = 2 }, true},
+		{"encryption", func(p *Policy) { p.EncryptionMode = "tpm" }, true},
+		{"cache mode", func(p *Policy) { p.CacheMode = "read-write" }, false},
+		{"quota limit", func(p *Policy) { p.MaxQuotaBytes = 1 << 30 }, false},
+	}
+	for _, tc := range cases {
+		to := Defaults
+		tc.change(&to)
+		if got := NeedsMigration(Defaults, to); got != tc.want {
+			t.Errorf("%s: NeedsMigration = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
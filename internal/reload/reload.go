@@ -0,0 +1,148 @@
+// Package reload re-reads configuration files without restarting the server,
+// either on SIGHUP or when a watched file changes. A file that fails to load
+// leaves the previous configuration in place.
+package reload
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Status reports the reload history of one source.
+type Status struct {
+	Name  string   `json:"name"`
+	Paths []string `json:"paths"`
+	// Generation counts successful loads, including the one at startup.
+	Generation int       `json:"generation"`
+	LoadedAt   time.Time `json:"loaded_at"`
+	// LastAttempt and LastError describe the most recent reload. LastError
+	// is cleared by a successful reload.
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+type source struct {
+	status Status
+	load   func() error
+	// seen holds the size and modification time of each path as of the
+	// last successful load, so a failed load is retried on the next poll.
+	seen []fileStamp
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// Watcher reloads registered sources.
+type Watcher struct {
+	mu      sync.Mutex
+	sources []*source
+	now     func() time.Time
+}
+
+// NewWatcher returns an empty watcher.
+func NewWatcher() *Watcher {
+	return &Watcher{now: time.Now}
+}
+
+// Add registers a source that has already been loaded once. load must
+// validate the files before swapping them in and leave the current
+// configuration alone when it fails.
+func (w *Watcher) Add(name string, paths []string, load func() error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sources = append(w.sources, &source{
+		status: Status{Name: name, Paths: paths, Generation: 1, LoadedAt: w.now().UTC()},
+		load:   load,
+		seen:   stamps(paths),
+	})
+}
+
+// Run reloads every source when hup delivers a signal and reloads changed
+// sources every interval, until stop is closed. An interval of zero disables
+// polling.
+func (w *Watcher) Run(interval time.Duration, hup <-chan os.Signal, stop <-chan struct{}) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			log.Printf("reload: SIGHUP received")
+			w.reload(true)
+		case <-tick:
+			w.reload(false)
+		}
+	}
+}
+
+// ReloadAll reloads every source regardless of whether its files changed.
+func (w *Watcher) ReloadAll() {
+	w.reload(true)
+}
+
+func (w *Watcher) reload(all bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, src := range w.sources {
+		current := stamps(src.status.Paths)
+		if !all && sameStamps(current, src.seen) {
+			continue
+		}
+		attempt := w.now().UTC()
+		src.status.LastAttempt = &attempt
+		if err := src.load(); err != nil {
+			src.status.LastError = err.Error()
+			log.Printf("reload %s: keeping previous configuration: %v", src.status.Name, err)
+			continue
+		}
+		src.seen = current
+		src.status.Generation++
+		src.status.LoadedAt = attempt
+		src.status.LastError = ""
+		log.Printf("reload %s: loaded generation %d", src.status.Name, src.status.Generation)
+	}
+}
+
+// Statuses returns the state of every source in registration order.
+func (w *Watcher) Statuses() []Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]Status, 0, len(w.sources))
+	for _, src := range w.sources {
+		out = append(out, src.status)
+	}
+	return out
+}
+
+// stamps records each path's size and modification time. Missing files get
+// a zero stamp, so a file reappearing counts as a change.
+func stamps(paths []string) []fileStamp {
+	out := make([]fileStamp, len(paths))
+	for i, p := range paths {
+		if info, err := os.Stat(p); err == nil {
+			out[i] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		}
+	}
+	return out
+}
+
+func sameStamps(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].size != b[i].size || !a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package reload
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestWatcherRetriesFailedLoad checks that a file that failed to load is
+// tried again on the next poll even though it has not changed since.
+func TestWatcherRetriesFailedLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	writeFile(t, path, []byte("{}"))
+	fail := true
+	w := NewWatcher()
+	w.Add("tokens", []string{path}, func() error {
+		if fail {
+			return errors.New("broken")
+		}
+		return nil
+	})
+
+	writeFile(t, path, []byte(`{"changed": true}`))
+	w.reload(false)
+	st := w.Statuses()[0]
+	if st.Generation != 1 || st.LastError == "" {
+		t.Fatalf("after failed load: %+v", st)
+	}
+
+	fail = false
+	w.reload(false)
+	st = w.Statuses()[0]
+	if st.Generation != 2 || st.LastError != "" {
+		t.Fatalf("failed load was not retried: %+v", st)
+	}
+
+	w.reload(false)
+	if st := w.Statuses()[0]; st.Generation != 2 {
+		t.Fatalf("unchanged file reloaded: %+v", st)
+	}
+}
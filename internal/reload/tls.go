@@ -0,0 +1,95 @@
+package reload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// nextProtos is offered on every configuration. The configuration returned
+// for each client replaces the server's own, so the ALPN protocols that
+// net/http would otherwise add must be set here.
+var nextProtos = []string{"h2", "http/1.1"}
+
+// TLS holds a server certificate and client CA bundle that can be replaced
+// while the server runs. New handshakes pick up the replacement; established
+// connections keep the configuration they negotiated.
+type TLS struct {
+	certPath, keyPath, clientCAPath string
+	clientAuth                      tls.ClientAuthType
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	current *tls.Config
+}
+
+// NewTLS loads the certificate, key and optional client CA bundle. With a
+// bundle, clients are verified according to clientAuth.
+func NewTLS(certPath, keyPath, clientCAPath string, clientAuth tls.ClientAuthType) (*TLS, error) {
+	t := &TLS{certPath: certPath, keyPath: keyPath, clientCAPath: clientCAPath, clientAuth: clientAuth}
+	if err := t.Load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Paths returns the files the configuration is read from.
+func (t *TLS) Paths() []string {
+	paths := []string{t.certPath, t.keyPath}
+	if t.clientCAPath != "" {
+		paths = append(paths, t.clientCAPath)
+	}
+	return paths
+}
+
+// Load reads the files again and swaps them in once all of them parse.
+func (t *TLS) Load() error {
+	cert, err := tls.LoadX509KeyPair(t.certPath, t.keyPath)
+	if err != nil {
+		return fmt.Errorf("load TLS keypair: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &cert, nil
+		},
+	}
+	if t.clientCAPath != "" {
+		caPEM, err := os.ReadFile(t.clientCAPath)
+		if err != nil {
+			return fmt.Errorf("read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no client CAs found in %s", t.clientCAPath)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = t.clientAuth
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cert, t.current = &cert, cfg
+	return nil
+}
+
+// Config returns a server configuration that resolves the current
+// certificate and client CAs on every handshake.
+func (t *TLS) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			t.mu.RLock()
+			defer t.mu.RUnlock()
+			return t.cert, nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			t.mu.RLock()
+			defer t.mu.RUnlock()
+			return t.current, nil
+		},
+	}
+}
@@ -0,0 +1,116 @@
+package reload
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeKeyPair writes a fresh self-signed certificate and its key and
+// returns the certificate's DER bytes.
+func writeKeyPair(t *testing.T, certPath, keyPath string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return der
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// served returns the certificate and configuration a new client would get.
+func served(t *testing.T, src *TLS) ([]byte, *tls.Config) {
+	t.Helper()
+	hello := &tls.ClientHelloInfo{}
+	cfg, err := src.Config().GetConfigForClient(hello)
+	if err != nil {
+		t.Fatalf("config for client: %v", err)
+	}
+	cert, err := cfg.GetCertificate(hello)
+	if err != nil {
+		t.Fatalf("certificate: %v", err)
+	}
+	return cert.Certificate[0], cfg
+}
+
+func TestTLSLoadKeepsCertificateOnBadFile(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first := writeKeyPair(t, certPath, keyPath)
+	src, err := NewTLS(certPath, keyPath, "", tls.NoClientCert)
+	if err != nil {
+		t.Fatalf("NewTLS: %v", err)
+	}
+
+	writeFile(t, certPath, []byte("not a certificate"))
+	if err := src.Load(); err == nil {
+		t.Fatal("Load accepted a bad certificate")
+	}
+	if got, _ := served(t, src); !bytes.Equal(got, first) {
+		t.Fatal("bad certificate replaced the loaded one")
+	}
+
+	second := writeKeyPair(t, certPath, keyPath)
+	if err := src.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got, _ := served(t, src); !bytes.Equal(got, second) {
+		t.Fatal("new certificate was not picked up")
+	}
+}
+
+// TestTLSConfigForClientOffersHTTP2 checks that the per-client
+// configuration keeps the ALPN protocols net/http adds to its own.
+func TestTLSConfigForClientOffersHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeKeyPair(t, certPath, keyPath)
+	src, err := NewTLS(certPath, keyPath, "", tls.NoClientCert)
+	if err != nil {
+		t.Fatalf("NewTLS: %v", err)
+	}
+	_, cfg := served(t, src)
+	for _, proto := range []string{"h2", "http/1.1"} {
+		if !slices.Contains(cfg.NextProtos, proto) {
+			t.Fatalf("NextProtos = %v, missing %s", cfg.NextProtos, proto)
+		}
+	}
+}
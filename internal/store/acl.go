@@ -0,0 +1,121 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Volume access verbs.
+const (
+	// VerbRead allows reading the volume's metadata and listing its
+	// snapshots.
+	VerbRead = "read"
+	// VerbAttachReadOnly allows read-only attachment.
+	VerbAttachReadOnly = "attach-ro"
+	// VerbAttachReadWrite allows read-write attachment. It implies
+	// VerbAttachReadOnly.
+	VerbAttachReadWrite = "attach-rw"
+	VerbSnapshot        = "snapshot"
+	// VerbRestore allows rolling the volume back to one of its snapshots.
+	VerbRestore = "restore"
+	VerbDelete  = "delete"
+	// VerbManage covers changes only the owner may make: resizing, policy
+	// and metadata changes, sharing and transfers. It cannot be granted.
+	VerbManage = "manage"
+)
+
+// ErrInvalidACL is returned for ACL entries that do not validate.
+var ErrInvalidACL = errors.New("invalid access control list")
+
+// ACLEntry grants a principal other than the owner a set of verbs on a
+// volume.
+type ACLEntry struct {
+	Principal string   `json:"principal"`
+	Verbs     []string `json:"verbs"`
+}
+
+// grantable reports whether verb may appear in an ACL entry.
+func grantable(verb string) bool {
+	switch verb {
+	case VerbRead, VerbAttachReadOnly, VerbAttachReadWrite, VerbSnapshot, VerbRestore, VerbDelete:
+		return true
+	}
+	return false
+}
+
+// KnownVerb reports whether verb is a volume access verb.
+func KnownVerb(verb string) bool {
+	return verb == VerbManage || grantable(verb)
+}
+
+// ValidateACL checks that every entry names a principal once, other than the
+// owner, and grants only known verbs.
+func ValidateACL(owner string, entries []ACLEntry) error {
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		switch {
+		case strings.TrimSpace(e.Principal) == "":
+			return fmt.Errorf("%w: entry without principal", ErrInvalidACL)
+		case e.Principal == owner:
+			return fmt.Errorf("%w: %s owns the volume", ErrInvalidACL, e.Principal)
+		case seen[e.Principal]:
+			return fmt.Errorf("%w: %s listed more than once", ErrInvalidACL, e.Principal)
+		case len(e.Verbs) == 0:
+			return fmt.Errorf("%w: %s is granted no verbs", ErrInvalidACL, e.Principal)
+		}
+		seen[e.Principal] = true
+		for _, verb := range e.Verbs {
+			if !grantable(verb) {
+				return fmt.Errorf("%w: unknown verb %q", ErrInvalidACL, verb)
+			}
+		}
+	}
+	return nil
+}
+
+// Allows reports whether principal may perform verb on the volume. The owner
+// may do everything. Any granted verb implies VerbRead.
+func (v Volume) Allows(principal, verb string) bool {
+	if principal == v.OwnerPrincipal {
+		return true
+	}
+	if verb == VerbManage {
+		return false
+	}
+	for _, e := range v.ACL {
+		if e.Principal == principal && VerbsAllow(e.Verbs, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerbsAllow reports whether a non-empty set of granted verbs covers verb.
+// Any grant implies VerbRead and VerbAttachReadWrite implies
+// VerbAttachReadOnly.
+func VerbsAllow(granted []string, verb string) bool {
+	if verb == VerbRead && len(granted) > 0 {
+		return true
+	}
+	for _, g := range granted {
+		if g == verb || (g == VerbAttachReadWrite && verb == VerbAttachReadOnly) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutPrincipal returns entries minus the one for principal.
+func withoutPrincipal(entries []ACLEntry, principal string) []ACLEntry {
+	out := make([]ACLEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.Principal != principal {
+			out = append(out, e)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
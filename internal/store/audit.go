@@ -0,0 +1,40 @@
+package store
+
+import "time"
+
+// maxAuditEvents caps the audit log; the oldest events are dropped first.
+const maxAuditEvents = 1000
+
+// AuditEvent records an administrative change to a resource.
+type AuditEvent struct {
+	EventID   string                 `json:"event_id"`
+	At        time.Time              `json:"at"`
+	Principal string                 `json:"principal,omitempty"`
+	Action    string                 `json:"action"`
+	Target    string                 `json:"target"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// AppendAudit timestamps and stores an audit event.
+func (s *FileStore) AppendAudit(ev AuditEvent) (AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ev.At = time.Now().UTC()
+	prev := s.audit
+	s.audit = append(append([]AuditEvent{}, s.audit...), ev)
+	if len(s.audit) > maxAuditEvents {
+		s.audit = s.audit[len(s.audit)-maxAuditEvents:]
+	}
+	if err := s.flushLocked(); err != nil {
+		s.audit = prev
+		return AuditEvent{}, err
+	}
+	return ev, nil
+}
+
+// ListAudit returns the audit log, oldest first.
+func (s *FileStore) ListAudit() []AuditEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]AuditEvent{}, s.audit...)
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// PoolUsage reports provisioned bytes against the pool capacity.
+type PoolUsage struct {
+	CapacityBytes    int64 `json:"capacity_bytes"`
+	ProvisionedBytes int64 `json:"provisioned_bytes"`
+}
+
+// Provisioned returns the bytes the volume holds in the pool. Volumes
+// recorded before provisioning was tracked count their quota.
+func (v Volume) Provisioned() int64 {
+	if v.ProvisionedBytes > 0 {
+		return v.ProvisionedBytes
+	}
+	return v.QuotaBytes
+}
+
+// SetPoolCapacity bounds the total provisioned bytes across volumes of a
+// class. Each class has its own pool. Zero disables the limit. Volumes
+// already over the limit are kept, but nothing new is provisioned until
+// usage drops below it.
+func (s *FileStore) SetPoolCapacity(class string, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bytes < 0 {
+		bytes = 0
+	}
+	s.poolCapacity[class] = bytes
+}
+
+// Pool returns the current usage of a class's pool.
+func (s *FileStore) Pool(class string) PoolUsage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return PoolUsage{CapacityBytes: s.poolCapacity[class], ProvisionedBytes: s.provisionedLocked(class)}
+}
+
+// ResizeVolume sets the volume quota and provisions its backing to match.
+// check runs against the current volume under the store lock and can veto
+// the resize; growth beyond the pool capacity returns ErrPoolExhausted.
+func (s *FileStore) ResizeVolume(id string, quotaBytes int64, check func(Volume) error) (Volume, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.volumes[id]
+	if !ok {
+		return Volume{}, ErrVolumeNotFound
+	}
+	if err := check(v); err != nil {
+		return Volume{}, err
+	}
+	if err := s.reserveLocked(v.poolClass(), quotaBytes-v.Provisioned()); err != nil {
+		return Volume{}, err
+	}
+	prev := v
+	v.QuotaBytes = quotaBytes
+	v.ProvisionedBytes = quotaBytes
+	v.UpdatedAt = time.Now().UTC()
+	s.volumes[id] = v
+	if err := s.flushLocked(); err != nil {
+		s.volumes[id] = prev
+		return Volume{}, err
+	}
+	return v, nil
+}
+
+// reserveLocked reports ErrPoolExhausted when provisioning grow more bytes
+// would exceed the class's pool capacity. Shrinking always succeeds.
+func (s *FileStore) reserveLocked(class string, grow int64) error {
+	capacity := s.poolCapacity[class]
+	if capacity == 0 || grow <= 0 {
+		return nil
+	}
+	if s.provisionedLocked(class)+grow > capacity {
+		return fmt.Errorf("%w: %s pool", ErrPoolExhausted, class)
+	}
+	return nil
+}
+
+func (s *FileStore) provisionedLocked(class string) int64 {
+	var total int64
+	for _, v := range s.volumes {
+		if v.poolClass() == class {
+			total += v.Provisioned()
+		}
+	}
+	return total
+}
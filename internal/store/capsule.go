@@ -0,0 +1,116 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CapsuleInfo describes the capsule payload stored alongside a checkpoint.
+type CapsuleInfo struct {
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	SHA256      string    `json:"sha256"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+// ErrCapsuleNotFound is returned when a checkpoint carries no capsule.
+var ErrCapsuleNotFound = errors.New("capsule not found")
+
+// PutCapsule writes a capsule payload next to the manifest and records its
+// metadata. An existing capsule for the checkpoint is replaced. The new
+// payload is staged and only moved into place once the metadata is
+// persisted, so a failed write leaves the previous capsule intact.
+func (s *FileStore) PutCapsule(manifestID, contentType string, data []byte) (Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.cp[manifestID]
+	if !ok {
+		return Checkpoint{}, ErrCheckpointNotFound
+	}
+
+	info, staged, err := s.stageCapsuleLocked(manifestID, contentType, data)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	prev := cp
+	cp.Capsule = &info
+	s.cp[manifestID] = cp
+	if err := s.flushLocked(); err != nil {
+		s.cp[manifestID] = prev
+		_ = os.Remove(staged)
+		return Checkpoint{}, err
+	}
+	if err := os.Rename(staged, s.capsulePath(manifestID)); err != nil {
+		_ = os.Remove(staged)
+		s.cp[manifestID] = prev
+		if ferr := s.flushLocked(); ferr != nil {
+			return Checkpoint{}, fmt.Errorf("replace capsule: %w (restoring metadata: %v)", err, ferr)
+		}
+		return Checkpoint{}, fmt.Errorf("replace capsule: %w", err)
+	}
+	return cp, nil
+}
+
+// ReadCapsule returns the capsule metadata and payload for a checkpoint.
+func (s *FileStore) ReadCapsule(manifestID string) (CapsuleInfo, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cp, ok := s.cp[manifestID]
+	if !ok {
+		return CapsuleInfo{}, nil, ErrCheckpointNotFound
+	}
+	if cp.Capsule == nil {
+		return CapsuleInfo{}, nil, ErrCapsuleNotFound
+	}
+	data, err := os.ReadFile(s.capsulePath(manifestID))
+	if err != nil {
+		return CapsuleInfo{}, nil, fmt.Errorf("read capsule: %w", err)
+	}
+	return *cp.Capsule, data, nil
+}
+
+// writeCapsuleLocked stores the payload of a checkpoint that has none yet.
+func (s *FileStore) writeCapsuleLocked(manifestID, contentType string, data []byte) (CapsuleInfo, error) {
+	info, staged, err := s.stageCapsuleLocked(manifestID, contentType, data)
+	if err != nil {
+		return CapsuleInfo{}, err
+	}
+	if err := os.Rename(staged, s.capsulePath(manifestID)); err != nil {
+		_ = os.Remove(staged)
+		return CapsuleInfo{}, fmt.Errorf("replace capsule: %w", err)
+	}
+	return info, nil
+}
+
+// stageCapsuleLocked writes the payload beside its final path and returns
+// its metadata and the staged file, which the caller renames into place.
+func (s *FileStore) stageCapsuleLocked(manifestID, contentType string, data []byte) (CapsuleInfo, string, error) {
+	if err := os.MkdirAll(s.capsuleDir(), 0o700); err != nil {
+		return CapsuleInfo{}, "", fmt.Errorf("create capsule directory: %w", err)
+	}
+	staged := s.capsulePath(manifestID) + ".tmp"
+	if err := os.WriteFile(staged, data, 0o600); err != nil {
+		_ = os.Remove(staged)
+		return CapsuleInfo{}, "", fmt.Errorf("write capsule: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return CapsuleInfo{
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		UploadedAt:  time.Now().UTC(),
+	}, staged, nil
+}
+
+func (s *FileStore) capsuleDir() string {
+	return filepath.Join(s.dir, "checkpoints")
+}
+
+func (s *FileStore) capsulePath(manifestID string) string {
+	return filepath.Join(s.capsuleDir(), manifestID+".capsule")
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPutCheckpointKeepsNoManifestWithoutCapsule checks that a manifest is
+// not recorded when its capsule cannot be written.
+func TestPutCheckpointKeepsNoManifestWithoutCapsule(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	// A file where the capsule directory belongs makes the write fail.
+	if err := os.WriteFile(filepath.Join(dir, "checkpoints"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.PutCheckpoint(Checkpoint{ManifestID: "cp-1"}, "application/json", []byte(`{}`)); err == nil {
+		t.Fatal("PutCheckpoint succeeded without a capsule directory")
+	}
+	if _, err := s.GetCheckpoint("cp-1"); !errors.Is(err, ErrCheckpointNotFound) {
+		t.Fatalf("GetCheckpoint = %v, want ErrCheckpointNotFound", err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "checkpoints")); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := s.PutCheckpoint(Checkpoint{ManifestID: "cp-1"}, "application/json", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("PutCheckpoint: %v", err)
+	}
+	if cp.Capsule == nil || cp.Capsule.SizeBytes != 2 {
+		t.Fatalf("capsule = %+v, want 2 bytes recorded", cp.Capsule)
+	}
+}
+
+// TestPutCapsuleKeepsPayloadWhenFlushFails checks that the stored digest
+// still describes the payload on disk after a failed replacement.
+func TestPutCapsuleKeepsPayloadWhenFlushFails(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	if _, err := s.PutCheckpoint(Checkpoint{ManifestID: "cp-1"}, "application/json", []byte(`{"v":1}`)); err != nil {
+		t.Fatalf("PutCheckpoint: %v", err)
+	}
+	// A directory where the state file is staged makes the flush fail.
+	blocker := filepath.Join(dir, "state.json.tmp")
+	if err := os.Mkdir(blocker, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.PutCapsule("cp-1", "application/json", []byte(`{"v":2}`)); err == nil {
+		t.Fatal("PutCapsule succeeded although the state could not be written")
+	}
+	info, data, err := s.ReadCapsule("cp-1")
+	if err != nil {
+		t.Fatalf("ReadCapsule: %v", err)
+	}
+	if string(data) != `{"v":1}` || info.SizeBytes != int64(len(data)) {
+		t.Fatalf("capsule = %s (%+v), want the original payload", data, info)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "checkpoints", "cp-1.capsule.tmp")); !os.IsNotExist(err) {
+		t.Fatalf("staged capsule left behind: %v", err)
+	}
+
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PutCapsule("cp-1", "application/json", []byte(`{"v":2}`)); err != nil {
+		t.Fatalf("PutCapsule: %v", err)
+	}
+	if _, data, _ := s.ReadCapsule("cp-1"); string(data) != `{"v":2}` {
+		t.Fatalf("capsule = %s, want the replacement", data)
+	}
+}
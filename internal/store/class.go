@@ -0,0 +1,29 @@
+package store
+
+// Volume classes.
+const (
+	// ClassPersistent volumes live until they are deleted.
+	ClassPersistent = "persistent"
+	// ClassEphemeral volumes are wiped and deleted when their last session
+	// detaches or their TTL lapses, and draw on their own pool capacity.
+	ClassEphemeral = "ephemeral"
+)
+
+// ValidClass reports whether class is a known volume class.
+func ValidClass(class string) bool {
+	return class == ClassPersistent || class == ClassEphemeral
+}
+
+// Ephemeral reports whether the volume belongs to the ephemeral class.
+func (v Volume) Ephemeral() bool {
+	return v.Class == ClassEphemeral
+}
+
+// poolClass names the pool the volume draws on. Records written before
+// classes were validated count against the persistent pool.
+func (v Volume) poolClass() string {
+	if v.Ephemeral() {
+		return ClassEphemeral
+	}
+	return ClassPersistent
+}
@@ -0,0 +1,14 @@
+package store
+
+// Volume export modes.
+const (
+	// ExportFS exposes the volume as a mounted filesystem.
+	ExportFS = "fs"
+	// ExportNBD exposes the volume as a network block device.
+	ExportNBD = "nbd"
+)
+
+// ValidExportMode reports whether mode is a known export mode.
+func ValidExportMode(mode string) bool {
+	return mode == ExportFS || mode == ExportNBD
+}
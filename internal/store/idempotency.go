@@ -0,0 +1,71 @@
+package store
+
+import "time"
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key, replayed when the caller retries with the same key.
+type IdempotencyRecord struct {
+	Principal   string    `json:"principal,omitempty"`
+	Key         string    `json:"key"`
+	RequestHash string    `json:"request_hash"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func idempotencyKey(principal, key string) string {
+	return principal + "\x00" + key
+}
+
+// GetIdempotency returns the record stored for a principal's key.
+func (s *FileStore) GetIdempotency(principal, key string) (IdempotencyRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.idempotency[idempotencyKey(principal, key)]
+	return rec, ok
+}
+
+// PutIdempotency stores a record, replacing any earlier one for the same
+// principal and key. Callers set CreatedAt from the clock they prune with.
+func (s *FileStore) PutIdempotency(rec IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := idempotencyKey(rec.Principal, rec.Key)
+	prev, existed := s.idempotency[k]
+	s.idempotency[k] = rec
+	if err := s.flushLocked(); err != nil {
+		if existed {
+			s.idempotency[k] = prev
+		} else {
+			delete(s.idempotency, k)
+		}
+		return err
+	}
+	return nil
+}
+
+// PruneIdempotency drops records created before cutoff and returns how many
+// were removed.
+func (s *FileStore) PruneIdempotency(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pruned := map[string]IdempotencyRecord{}
+	for k, rec := range s.idempotency {
+		if rec.CreatedAt.Before(cutoff) {
+			pruned[k] = rec
+			delete(s.idempotency, k)
+		}
+	}
+	if len(pruned) == 0 {
+		return 0, nil
+	}
+	if err := s.flushLocked(); err != nil {
+		for k, rec := range pruned {
+			s.idempotency[k] = rec
+		}
+		return 0, err
+	}
+	return len(pruned), nil
+}
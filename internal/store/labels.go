@@ -0,0 +1,184 @@
+package store
+
+import (
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/labels"
+)
+
+// labelIndex maps label key to value to the IDs of volumes carrying that
+// pair.
+type labelIndex map[string]map[string]map[string]struct{}
+
+// update moves a volume's index entries from its old labels to its new ones.
+func (ix labelIndex) update(id string, old, new map[string]string) {
+	for k, v := range old {
+		if ids := ix[k][v]; ids != nil {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(ix[k], v)
+			}
+		}
+		if len(ix[k]) == 0 {
+			delete(ix, k)
+		}
+	}
+	for k, v := range new {
+		if ix[k] == nil {
+			ix[k] = map[string]map[string]struct{}{}
+		}
+		if ix[k][v] == nil {
+			ix[k][v] = map[string]struct{}{}
+		}
+		ix[k][v][id] = struct{}{}
+	}
+}
+
+// candidates returns the IDs that can satisfy req, or false when the index
+// cannot narrow it down.
+func (ix labelIndex) candidates(req labels.Requirement) (map[string]struct{}, bool) {
+	switch req.Operator {
+	case labels.Equals, labels.In:
+		out := map[string]struct{}{}
+		for _, v := range req.Values {
+			for id := range ix[req.Key][v] {
+				out[id] = struct{}{}
+			}
+		}
+		return out, true
+	case labels.Exists:
+		out := map[string]struct{}{}
+		for _, ids := range ix[req.Key] {
+			for id := range ids {
+				out[id] = struct{}{}
+			}
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func (s *FileStore) reindexLocked() {
+	s.labelIndex = labelIndex{}
+	for id, v := range s.volumes {
+		s.labelIndex.update(id, nil, v.Labels)
+	}
+}
+
+// SelectVolumes returns the volumes whose labels match sel. Positive
+// requirements are answered from the label index; the rest are checked
+// against each candidate.
+func (s *FileStore) SelectVolumes(sel labels.Selector) []Volume {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var narrowed map[string]struct{}
+	for _, req := range sel {
+		ids, ok := s.labelIndex.candidates(req)
+		if !ok {
+			continue
+		}
+		if narrowed == nil || len(ids) < len(narrowed) {
+			narrowed = ids
+		}
+	}
+	out := make([]Volume, 0)
+	if narrowed != nil {
+		for id := range narrowed {
+			if v, ok := s.volumes[id]; ok && sel.Matches(v.Labels) {
+				out = append(out, v)
+			}
+		}
+		sortVolumes(out)
+		return out
+	}
+	for _, v := range s.volumes {
+		if sel.Matches(v.Labels) {
+			out = append(out, v)
+		}
+	}
+	sortVolumes(out)
+	return out
+}
+
+// ValidateMetadata checks a label and annotation set.
+func ValidateMetadata(labelSet, annotations map[string]string) error {
+	if err := labels.Validate(labelSet); err != nil {
+		return err
+	}
+	return labels.ValidateAnnotations(annotations)
+}
+
+// PatchVolumeMetadata applies label and annotation patches to a volume.
+func (s *FileStore) PatchVolumeMetadata(id string, labelPatch, annotationPatch labels.Patch) (Volume, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.volumes[id]
+	if !ok {
+		return Volume{}, ErrVolumeNotFound
+	}
+	prev := v
+	v.Labels = labelPatch.Apply(v.Labels)
+	v.Annotations = annotationPatch.Apply(v.Annotations)
+	if err := ValidateMetadata(v.Labels, v.Annotations); err != nil {
+		return Volume{}, err
+	}
+	v.UpdatedAt = time.Now().UTC()
+	s.volumes[id] = v
+	s.labelIndex.update(id, prev.Labels, v.Labels)
+	if err := s.flushLocked(); err != nil {
+		s.volumes[id] = prev
+		s.labelIndex.update(id, v.Labels, prev.Labels)
+		return Volume{}, err
+	}
+	return v, nil
+}
+
+// PatchSnapshotMetadata applies label and annotation patches to a snapshot.
+func (s *FileStore) PatchSnapshotMetadata(snapshotID string, labelPatch, annotationPatch labels.Patch) (Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for vid, snaps := range s.snaps {
+		for i, snap := range snaps {
+			if snap.SnapshotID != snapshotID {
+				continue
+			}
+			snap.Labels = labelPatch.Apply(snap.Labels)
+			snap.Annotations = annotationPatch.Apply(snap.Annotations)
+			if err := ValidateMetadata(snap.Labels, snap.Annotations); err != nil {
+				return Snapshot{}, err
+			}
+			list := append([]Snapshot{}, snaps...)
+			list[i] = snap
+			s.snaps[vid] = list
+			if err := s.flushLocked(); err != nil {
+				s.snaps[vid] = snaps
+				return Snapshot{}, err
+			}
+			return snap, nil
+		}
+	}
+	return Snapshot{}, ErrSnapshotNotFound
+}
+
+// PatchCheckpointMetadata applies label and annotation patches to a
+// checkpoint manifest.
+func (s *FileStore) PatchCheckpointMetadata(id string, labelPatch, annotationPatch labels.Patch) (Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.cp[id]
+	if !ok {
+		return Checkpoint{}, ErrCheckpointNotFound
+	}
+	prev := cp
+	cp.Labels = labelPatch.Apply(cp.Labels)
+	cp.Annotations = annotationPatch.Apply(cp.Annotations)
+	if err := ValidateMetadata(cp.Labels, cp.Annotations); err != nil {
+		return Checkpoint{}, err
+	}
+	s.cp[id] = cp
+	if err := s.flushLocked(); err != nil {
+		s.cp[id] = prev
+		return Checkpoint{}, err
+	}
+	return cp, nil
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"errors"
+	"regexp"
+)
+
+// ErrNameTaken is returned when an owner already has a volume with the name.
+var ErrNameTaken = errors.New("volume name already in use")
+
+var volumeName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// ValidName reports whether name is a valid volume name: up to 63 lowercase
+// alphanumerics and dashes, starting and ending with an alphanumeric.
+func ValidName(name string) bool {
+	return len(name) <= 63 && volumeName.MatchString(name)
+}
+
+type nameKey struct {
+	owner, name string
+}
+
+// nameIndex maps an owner's volume names to volume IDs.
+type nameIndex map[nameKey]string
+
+func (ix nameIndex) update(id string, old, new Volume) {
+	if old.Name != "" && ix[nameKey{old.OwnerPrincipal, old.Name}] == id {
+		delete(ix, nameKey{old.OwnerPrincipal, old.Name})
+	}
+	if new.Name != "" {
+		ix[nameKey{new.OwnerPrincipal, new.Name}] = id
+	}
+}
+
+// claimedLocked reports whether v's name belongs to another of its owner's
+// volumes.
+func (s *FileStore) claimedLocked(v Volume) bool {
+	if v.Name == "" {
+		return false
+	}
+	id, ok := s.names[nameKey{v.OwnerPrincipal, v.Name}]
+	return ok && id != v.VolumeID
+}
+
+func (s *FileStore) reindexNamesLocked() {
+	s.names = nameIndex{}
+	for id, v := range s.volumes {
+		s.names.update(id, Volume{}, v)
+	}
+}
+
+// GetVolumeByName returns the owner's volume with the given name.
+func (s *FileStore) GetVolumeByName(owner, name string) (Volume, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.names[nameKey{owner, name}]
+	if !ok {
+		return Volume{}, ErrVolumeNotFound
+	}
+	return s.volumes[id], nil
+}
+
+// FindVolumesByName returns every owner's volume with the given name.
+func (s *FileStore) FindVolumesByName(name string) []Volume {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Volume, 0)
+	for key, id := range s.names {
+		if key.name == name {
+			out = append(out, s.volumes[id])
+		}
+	}
+	sortVolumes(out)
+	return out
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Operation states.
+const (
+	OperationPending   = "pending"
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+	OperationCancelled = "cancelled"
+)
+
+// Operation tracks long-running work such as provisioning, snapshotting and
+// checkpoint restores.
+type Operation struct {
+	OperationID string            `json:"operation_id"`
+	Kind        string            `json:"kind"`
+	Target      string            `json:"target"`
+	Principal   string            `json:"principal,omitempty"`
+	State       string            `json:"state"`
+	Progress    OperationProgress `json:"progress"`
+	Error       string            `json:"error,omitempty"`
+	// CancelRequested is set once a caller asks for cancellation; the worker
+	// moves the operation to "cancelled" when it observes the request.
+	CancelRequested bool            `json:"cancel_requested,omitempty"`
+	Result          json.RawMessage `json:"result,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	CompletedAt     *time.Time      `json:"completed_at,omitempty"`
+}
+
+// OperationProgress counts completed steps out of the total.
+type OperationProgress struct {
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+}
+
+// ErrOperationNotFound is returned when an operation ID does not exist.
+var ErrOperationNotFound = errors.New("operation not found")
+
+// PutOperation upserts an operation record and persists to disk.
+func (s *FileStore) PutOperation(op Operation) (Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	if existing, ok := s.ops[op.OperationID]; ok {
+		op.CreatedAt = existing.CreatedAt
+		// Cancellation requests are sticky so a worker saving progress
+		// cannot clear one it has not observed yet.
+		op.CancelRequested = op.CancelRequested || existing.CancelRequested
+	} else {
+		op.CreatedAt = now
+	}
+	op.UpdatedAt = now
+	s.ops[op.OperationID] = op
+	if err := s.flushLocked(); err != nil {
+		return Operation{}, err
+	}
+	return op, nil
+}
+
+// GetOperation returns an operation by ID.
+func (s *FileStore) GetOperation(id string) (Operation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	op, ok := s.ops[id]
+	if !ok {
+		return Operation{}, ErrOperationNotFound
+	}
+	return op, nil
+}
+
+// RequestOperationCancel flags an in-flight operation for cancellation and
+// returns the current record. Finished operations are returned unchanged.
+func (s *FileStore) RequestOperationCancel(id string) (Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.ops[id]
+	if !ok {
+		return Operation{}, ErrOperationNotFound
+	}
+	if op.Terminal() || op.CancelRequested {
+		return op, nil
+	}
+	op.CancelRequested = true
+	op.UpdatedAt = time.Now().UTC()
+	s.ops[id] = op
+	if err := s.flushLocked(); err != nil {
+		return Operation{}, err
+	}
+	return op, nil
+}
+
+// ListOperations returns all operations, oldest first.
+func (s *FileStore) ListOperations() []Operation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Operation, 0, len(s.ops))
+	for _, op := range s.ops {
+		out = append(out, op)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+// Terminal reports whether the operation has finished.
+func (o Operation) Terminal() bool {
+	switch o.State {
+	case OperationSucceeded, OperationFailed, OperationCancelled:
+		return true
+	}
+	return false
+}
+
+// failInterruptedLocked marks operations that were in flight when the process
+// stopped as failed; their workers did not survive the restart.
+func (s *FileStore) failInterruptedLocked() {
+	now := time.Now().UTC()
+	for id, op := range s.ops {
+		if op.Terminal() {
+			continue
+		}
+		op.State = OperationFailed
+		op.Error = "interrupted by server restart"
+		op.UpdatedAt = now
+		op.CompletedAt = &now
+		s.ops[id] = op
+	}
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/AtDexters-Lab/aionFS/internal/policy"
+)
+
+var (
+	// ErrProfileExists is returned when creating a profile whose name is
+	// taken.
+	ErrProfileExists = errors.New("policy profile already exists")
+	// ErrProfileInUse is returned when deleting a profile that a volume uses
+	// or another profile inherits from.
+	ErrProfileInUse = errors.New("policy profile in use")
+)
+
+// GetProfile returns a policy profile by name.
+func (s *FileStore) GetProfile(name string) (policy.Profile, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.profiles[name]
+	return p, ok
+}
+
+// ListProfiles returns all policy profiles sorted by name.
+func (s *FileStore) ListProfiles() []policy.Profile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]policy.Profile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// ResolvePolicy returns the effective policy for the named profile.
+func (s *FileStore) ResolvePolicy(name string) (policy.Effective, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return policy.Resolve(name, s.lookupProfileLocked)
+}
+
+// PutProfile creates or replaces a policy profile and reports whether it was
+// created. With create set, an existing profile returns ErrProfileExists.
+// The profile's parent chain must resolve.
+func (s *FileStore) PutProfile(p policy.Profile, create bool) (bool, error) {
+	if err := p.Validate(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, existed := s.profiles[p.Name]
+	if existed && create {
+		return false, ErrProfileExists
+	}
+	s.profiles[p.Name] = p
+	restore := func() {
+		if existed {
+			s.profiles[p.Name] = prev
+		} else {
+			delete(s.profiles, p.Name)
+		}
+	}
+	if _, err := policy.Resolve(p.Name, s.lookupProfileLocked); err != nil {
+		restore()
+		return false, err
+	}
+	if err := s.flushLocked(); err != nil {
+		restore()
+		return false, err
+	}
+	return !existed, nil
+}
+
+// DeleteProfile removes a policy profile no volume or profile refers to.
+func (s *FileStore) DeleteProfile(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.profiles[name]
+	if !ok {
+		return policy.ErrProfileNotFound
+	}
+	for _, v := range s.volumes {
+		if v.PolicyProfile == name {
+			return fmt.Errorf("%w: volume %s uses it", ErrProfileInUse, v.VolumeID)
+		}
+	}
+	for _, other := range s.profiles {
+		if other.Parent == name {
+			return fmt.Errorf("%w: profile %s inherits from it", ErrProfileInUse, other.Name)
+		}
+	}
+	delete(s.profiles, name)
+	if err := s.flushLocked(); err != nil {
+		s.profiles[name] = p
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) lookupProfileLocked(name string) (policy.Profile, bool) {
+	p, ok := s.profiles[name]
+	return p, ok
+}
+
+// seedProfiles installs the built-in profiles into a store that has none.
+func (s *FileStore) seedProfiles() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.profiles) > 0 {
+		return
+	}
+	for _, p := range policy.Builtins() {
+		s.profiles[p.Name] = p
+	}
+}
@@ -0,0 +1,68 @@
+package store
+
+import "time"
+
+// RevokedToken is a deny-list entry for a token the server minted. It is kept
+// until ExpiresAt, after which the token would be refused anyway.
+type RevokedToken struct {
+	TokenID   string    `json:"token_id"`
+	RevokedAt time.Time `json:"revoked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RevokeToken adds a token to the deny list. Revoking a token twice keeps the
+// later expiry.
+func (s *FileStore) RevokeToken(tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, existed := s.revoked[tokenID]
+	if existed && !prev.ExpiresAt.Before(expiresAt) {
+		return nil
+	}
+	s.revoked[tokenID] = RevokedToken{
+		TokenID:   tokenID,
+		RevokedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt.UTC(),
+	}
+	if err := s.flushLocked(); err != nil {
+		if existed {
+			s.revoked[tokenID] = prev
+		} else {
+			delete(s.revoked, tokenID)
+		}
+		return err
+	}
+	return nil
+}
+
+// TokenRevoked reports whether a token is on the deny list.
+func (s *FileStore) TokenRevoked(tokenID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.revoked[tokenID]
+	return ok
+}
+
+// PruneRevokedTokens drops deny-list entries that expired before now and
+// returns how many were removed.
+func (s *FileStore) PruneRevokedTokens(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pruned := map[string]RevokedToken{}
+	for id, rt := range s.revoked {
+		if rt.ExpiresAt.Before(now) {
+			pruned[id] = rt
+			delete(s.revoked, id)
+		}
+	}
+	if len(pruned) == 0 {
+		return 0, nil
+	}
+	if err := s.flushLocked(); err != nil {
+		for id, rt := range pruned {
+			s.revoked[id] = rt
+		}
+		return 0, err
+	}
+	return len(pruned), nil
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+)
+
+// Volume access modes.
+const (
+	// AccessSingleWriter admits one session at a time.
+	AccessSingleWriter = "single-writer"
+	// AccessManyReaders admits any number of read-only sessions and at most
+	// one read-write session.
+	AccessManyReaders = "many-readers"
+	// AccessManyWriters admits any number of sessions of either kind.
+	AccessManyWriters = "many-writers"
+)
+
+// ValidAccessMode reports whether mode is a known access mode.
+func ValidAccessMode(mode string) bool {
+	switch mode {
+	case AccessSingleWriter, AccessManyReaders, AccessManyWriters:
+		return true
+	}
+	return false
+}
+
+// Session returns the attached session with the given ID.
+func (v Volume) Session(sessionID string) (Session, bool) {
+	for _, session := range v.AttachSessions {
+		if session.SessionID == sessionID {
+			return session, true
+		}
+	}
+	return Session{}, false
+}
+
+// AttachVolume applies mutate to add a session. An available volume moves to
+// attached; a volume that is already attached stays there so further sessions
+// can join it. mutate is expected to append to AttachSessions and may veto
+// the attach by returning an error.
+func (s *FileStore) AttachVolume(id, reason, principal string, mutate func(*Volume) error) (Volume, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.volumes[id]
+	if !ok {
+		return Volume{}, ErrVolumeNotFound
+	}
+	from := v.AttachState
+	if from != lifecycle.Attached {
+		if err := lifecycle.Check(from, lifecycle.Attached); err != nil {
+			return Volume{}, err
+		}
+	}
+	prev := v
+	v.AttachSessions = append([]Session{}, v.AttachSessions...)
+	v.Transitions = append([]lifecycle.Transition{}, v.Transitions...)
+	if err := mutate(&v); err != nil {
+		return Volume{}, err
+	}
+	now := time.Now().UTC()
+	if from != lifecycle.Attached {
+		v.recordTransition(lifecycle.Attached, reason, principal, now)
+	}
+	v.UpdatedAt = now
+	s.volumes[id] = v
+	if err := s.flushLocked(); err != nil {
+		s.volumes[id] = prev
+		return Volume{}, err
+	}
+	return v, nil
+}
+
+// DetachSessions removes the sessions chosen by choose from an attached
+// volume and returns them. When the last session leaves, the volume passes
+// through detaching back to available in the same write.
+func (s *FileStore) DetachSessions(id, reason, principal string, choose func(Volume) ([]Session, error)) (Volume, []Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.volumes[id]
+	if !ok {
+		return Volume{}, nil, ErrVolumeNotFound
+	}
+	if err := lifecycle.Check(v.AttachState, lifecycle.Detaching); err != nil {
+		return Volume{}, nil, err
+	}
+	chosen, err := choose(v)
+	if err != nil {
+		return Volume{}, nil, err
+	}
+	drop := make(map[string]bool, len(chosen))
+	for _, session := range chosen {
+		drop[session.SessionID] = true
+	}
+	prev := v
+	remaining := make([]Session, 0, len(v.AttachSessions))
+	for _, session := range v.AttachSessions {
+		if !drop[session.SessionID] {
+			remaining = append(remaining, session)
+		}
+	}
+	v.AttachSessions = remaining
+	now := time.Now().UTC()
+	if len(remaining) == 0 {
+		v.AttachSessions = nil
+		v.Transitions = append([]lifecycle.Transition{}, v.Transitions...)
+		v.recordTransition(lifecycle.Detaching, reason, principal, now)
+		v.recordTransition(lifecycle.Available, reason, principal, now)
+	}
+	v.UpdatedAt = now
+	s.volumes[id] = v
+	if err := s.flushLocked(); err != nil {
+		s.volumes[id] = prev
+		return Volume{}, nil, err
+	}
+	return v, chosen, nil
+}
+
+// recordTransition moves v to state to and appends the change to its
+// history. The caller has already validated the move.
+func (v *Volume) recordTransition(to lifecycle.State, reason, principal string, at time.Time) {
+	v.Transitions = append(v.Transitions, lifecycle.Transition{
+		From:      v.AttachState,
+		To:        to,
+		Reason:    reason,
+		Principal: principal,
+		At:        at,
+	})
+	if len(v.Transitions) > maxTransitions {
+		v.Transitions = v.Transitions[len(v.Transitions)-maxTransitions:]
+	}
+	v.AttachState = to
+	v.MountHandle.State = to
+}
+
+// migrateSessionsLocked upgrades volumes written before multi-attach.
+func (s *FileStore) migrateSessionsLocked() {
+	for id, v := range s.volumes {
+		if v.AccessMode != "" && v.LegacySession == nil {
+			continue
+		}
+		if v.AccessMode == "" {
+			v.AccessMode = AccessSingleWriter
+		}
+		if v.LegacySession != nil {
+			if len(v.AttachSessions) == 0 {
+				session := *v.LegacySession
+				session.MountPath = v.MountHandle.HostPath
+				v.AttachSessions = []Session{session}
+			}
+			v.LegacySession = nil
+		}
+		s.volumes[id] = v
+	}
+}
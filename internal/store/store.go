@@ -6,30 +6,72 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/AtDexters-Lab/aionFS/internal/ids"
+	"github.com/AtDexters-Lab/aionFS/internal/lifecycle"
+	"github.com/AtDexters-Lab/aionFS/internal/policy"
 )
 
 // Volume represents the minimal metadata tracked by the dev server.
 type Volume struct {
-	VolumeID       string    `json:"volume_id"`
-	OwnerPrincipal string    `json:"owner_principal"`
-	Class          string    `json:"class"`
-	QuotaBytes     int64     `json:"quota_bytes"`
-	PolicyProfile  string    `json:"policy_profile"`
-	ExportMode     string    `json:"export_mode"`
-	MountHandle    MountInfo `json:"mount_handle"`
-	AttachState    string    `json:"attach_state"`
-	AttachSession  *Session  `json:"attach_session,omitempty"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	VolumeID string `json:"volume_id"`
+	// Name is an optional handle unique among the owner's volumes.
+	Name           string `json:"name,omitempty"`
+	OwnerPrincipal string `json:"owner_principal"`
+	Class          string `json:"class"`
+	QuotaBytes     int64  `json:"quota_bytes"`
+	// ProvisionedBytes is the size of the backing allocation counted
+	// against pool capacity. It follows QuotaBytes once a resize completes.
+	ProvisionedBytes int64 `json:"provisioned_bytes,omitempty"`
+	// UsedBytes is the usage last reported by a session heartbeat.
+	UsedBytes     int64  `json:"used_bytes,omitempty"`
+	PolicyProfile string `json:"policy_profile"`
+	// Policy is the resolved policy the backing currently satisfies.
+	Policy *policy.Policy `json:"policy,omitempty"`
+	// PendingMigration names the operation rewriting data after a policy
+	// change.
+	PendingMigration string          `json:"pending_migration,omitempty"`
+	ExportMode       string          `json:"export_mode"`
+	MountHandle      MountInfo       `json:"mount_handle"`
+	AttachState      lifecycle.State `json:"attach_state"`
+	// AccessMode limits how many sessions may hold the volume at once.
+	AccessMode     string    `json:"access_mode"`
+	AttachSessions []Session `json:"attach_sessions,omitempty"`
+	// LegacySession is the single session written by older state files. It
+	// is moved into AttachSessions on load and never written back.
+	LegacySession *Session `json:"attach_session,omitempty"`
+	// FencingGeneration is the last generation granted; every successful
+	// attach takes the next one. Calls carrying a superseded generation
+	// are refused.
+	FencingGeneration uint64 `json:"fencing_generation,omitempty"`
+	// Labels are validated key/value pairs used by selectors; Annotations
+	// are free-form.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ExpiresAt is when an ephemeral volume is wiped if it is still around.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// PendingTransfer is an ownership transfer awaiting acceptance.
+	PendingTransfer *Transfer `json:"pending_transfer,omitempty"`
+	// ACL shares the volume with principals other than the owner.
+	ACL []ACLEntry `json:"acl,omitempty"`
+	// RestoredFrom is the snapshot the volume contents were last restored from.
+	RestoredFrom string `json:"restored_from,omitempty"`
+	// Transitions holds the most recent lifecycle changes, oldest first.
+	Transitions []lifecycle.Transition `json:"transitions,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
 }
 
 // MountInfo exposes information about the prepared export.
 type MountInfo struct {
 	Mode     string `json:"mode"`
 	HostPath string `json:"host_path"`
-	State    string `json:"state"`
+	// ReadOnlyPath is the export handed to read-only sessions.
+	ReadOnlyPath string          `json:"read_only_path,omitempty"`
+	State        lifecycle.State `json:"state"`
 }
 
 // Session captures attach metadata for bookkeeping.
@@ -38,6 +80,20 @@ type Session struct {
 	Principal        string    `json:"principal"`
 	ConsumerEndpoint string    `json:"consumer_endpoint"`
 	AttachedAt       time.Time `json:"attached_at"`
+	// LeaseExpiresAt is when the session lapses unless renewed by a
+	// heartbeat. Sessions recorded before leases existed leave it zero and
+	// never expire.
+	LeaseExpiresAt time.Time `json:"lease_expires_at,omitempty"`
+	// Generation is the volume's fencing generation granted at attach.
+	Generation uint64 `json:"generation,omitempty"`
+	ReadOnly   bool   `json:"read_only"`
+	// MountPath is the export this session should mount.
+	MountPath string `json:"mount_path,omitempty"`
+}
+
+// Expired reports whether the session's lease lapsed before now.
+func (s Session) Expired(now time.Time) bool {
+	return !s.LeaseExpiresAt.IsZero() && !now.Before(s.LeaseExpiresAt)
 }
 
 // Snapshot represents a point-in-time capture placeholder.
@@ -46,6 +102,9 @@ type Snapshot struct {
 	VolumeID   string    `json:"volume_id"`
 	CreatedAt  time.Time `json:"created_at"`
 	Note       string    `json:"note,omitempty"`
+	// Labels and Annotations follow the same rules as on volumes.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // Checkpoint groups snapshot identifiers for recovery stubs.
@@ -54,38 +113,92 @@ type Checkpoint struct {
 	SnapshotIDs []string  `json:"snapshot_ids"`
 	CreatedAt   time.Time `json:"created_at"`
 	Note        string    `json:"note,omitempty"`
+	// Consistency is "crash" when every snapshot was captured under a shared
+	// write barrier; empty manifests reuse each volume's latest snapshot.
+	Consistency string `json:"consistency,omitempty"`
+	// CaptureSkewNanos is how long a crash-consistent capture held writes,
+	// from the write barrier going up until the snapshots were persisted.
+	CaptureSkewNanos int64 `json:"capture_skew_ns,omitempty"`
+	// OwnerPrincipal is the caller that created the manifest. Manifests
+	// written before it was recorded leave it empty.
+	OwnerPrincipal string            `json:"owner_principal,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+	Capsule        *CapsuleInfo      `json:"capsule,omitempty"`
 }
 
 type fileState struct {
-	Volumes     map[string]Volume     `json:"volumes"`
-	Snapshots   map[string][]Snapshot `json:"snapshots"`
-	Checkpoints map[string]Checkpoint `json:"checkpoints"`
+	Volumes     map[string]Volume            `json:"volumes"`
+	Snapshots   map[string][]Snapshot        `json:"snapshots"`
+	Checkpoints map[string]Checkpoint        `json:"checkpoints"`
+	Operations  map[string]Operation         `json:"operations"`
+	Audit       []AuditEvent                 `json:"audit,omitempty"`
+	Idempotency map[string]IdempotencyRecord `json:"idempotency,omitempty"`
+	Profiles    map[string]policy.Profile    `json:"policy_profiles,omitempty"`
+	Revoked     map[string]RevokedToken      `json:"revoked_tokens,omitempty"`
 }
 
 // FileStore is a naive JSON-backed persistence layer for dev use.
 type FileStore struct {
 	mu      sync.RWMutex
+	dir     string
 	path    string
 	volumes map[string]Volume
 	snaps   map[string][]Snapshot
 	cp      map[string]Checkpoint
+	ops     map[string]Operation
+	audit   []AuditEvent
+	// idempotency holds replayable responses keyed by principal and key.
+	idempotency map[string]IdempotencyRecord
+	profiles    map[string]policy.Profile
+	// revoked is the deny list of minted tokens, keyed by token ID.
+	revoked map[string]RevokedToken
+	// poolCapacity bounds the sum of provisioned bytes per volume class;
+	// zero or missing is unlimited.
+	poolCapacity map[string]int64
+	// labelIndex maps volume label pairs to volume IDs for selector queries.
+	labelIndex labelIndex
+	// names maps each owner's volume names to volume IDs.
+	names nameIndex
 }
 
-// ErrVolumeNotFound is returned when a requested ID does not exist.
-var ErrVolumeNotFound = errors.New("volume not found")
+var (
+	// ErrVolumeNotFound is returned when a requested ID does not exist.
+	ErrVolumeNotFound = errors.New("volume not found")
+	// ErrCheckpointNotFound is returned when a manifest ID does not exist.
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+	// ErrSnapshotNotFound is returned when a snapshot ID does not exist.
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrPoolExhausted is returned when provisioning would exceed the pool
+	// capacity.
+	ErrPoolExhausted = errors.New("storage pool capacity exhausted")
+	// ErrIDConflict is returned when a create would overwrite an existing
+	// record with the same ID.
+	ErrIDConflict = errors.New("resource id already exists")
+)
 
 // NewFileStore loads persisted state (if present) from disk.
 func NewFileStore(dataDir string) (*FileStore, error) {
 	st := &FileStore{
-		path:    filepath.Join(dataDir, "state.json"),
-		volumes: map[string]Volume{},
-		snaps:   map[string][]Snapshot{},
-		cp:      map[string]Checkpoint{},
+		dir:      dataDir,
+		path:     filepath.Join(dataDir, "state.json"),
+		volumes:  map[string]Volume{},
+		snaps:    map[string][]Snapshot{},
+		cp:       map[string]Checkpoint{},
+		ops:      map[string]Operation{},
+		profiles: map[string]policy.Profile{},
+
+		idempotency:  map[string]IdempotencyRecord{},
+		revoked:      map[string]RevokedToken{},
+		poolCapacity: map[string]int64{},
+		labelIndex:   labelIndex{},
+		names:        nameIndex{},
 	}
 
 	if err := st.load(); err != nil {
 		return nil, err
 	}
+	st.seedProfiles()
 	return st, nil
 }
 
@@ -102,9 +215,20 @@ func (s *FileStore) ListVolumes() []Volume {
 	for _, v := range s.volumes {
 		out = append(out, v)
 	}
+	sortVolumes(out)
 	return out
 }
 
+// sortVolumes orders volumes by ID, which is also creation order for IDs
+// minted by the ids package.
+func sortVolumes(vols []Volume) {
+	sort.Slice(vols, func(i, j int) bool { return ids.Less(vols[i].VolumeID, vols[j].VolumeID) })
+}
+
+func sortIDs(list []string) {
+	sort.Slice(list, func(i, j int) bool { return ids.Less(list[i], list[j]) })
+}
+
 // ListVolumesByOwner returns volumes filtered by owner principal.
 func (s *FileStore) ListVolumesByOwner(owner string) []Volume {
 	s.mu.RLock()
@@ -115,6 +239,7 @@ func (s *FileStore) ListVolumesByOwner(owner string) []Volume {
 			out = append(out, v)
 		}
 	}
+	sortVolumes(out)
 	return out
 }
 
@@ -129,23 +254,30 @@ func (s *FileStore) GetVolume(id string) (Volume, error) {
 	return v, nil
 }
 
-// PutVolume upserts volume metadata and persists to disk.
+// PutVolume stores a new volume and persists to disk. It refuses to
+// overwrite an existing volume with the same ID.
 func (s *FileStore) PutVolume(v Volume) (Volume, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if _, exists := s.volumes[v.VolumeID]; exists {
+		return Volume{}, fmt.Errorf("%w: volume %s", ErrIDConflict, v.VolumeID)
+	}
+	if s.claimedLocked(v) {
+		return Volume{}, ErrNameTaken
+	}
+	if err := s.reserveLocked(v.poolClass(), v.Provisioned()); err != nil {
+		return Volume{}, err
+	}
 	now := time.Now().UTC()
+	v.CreatedAt = now
 	v.UpdatedAt = now
-	if existing, ok := s.volumes[v.VolumeID]; ok {
-		if !existing.CreatedAt.IsZero() {
-			v.CreatedAt = existing.CreatedAt
-		} else {
-			v.CreatedAt = now
-		}
-	} else {
-		v.CreatedAt = now
-	}
 	s.volumes[v.VolumeID] = v
+	s.labelIndex.update(v.VolumeID, nil, v.Labels)
+	s.names.update(v.VolumeID, Volume{}, v)
 	if err := s.flushLocked(); err != nil {
+		delete(s.volumes, v.VolumeID)
+		s.labelIndex.update(v.VolumeID, v.Labels, nil)
+		s.names.update(v.VolumeID, v, Volume{})
 		return Volume{}, err
 	}
 	return v, nil
@@ -158,14 +290,47 @@ func (s *FileStore) AddSnapshot(volumeID string, snap Snapshot) (Snapshot, error
 	if _, ok := s.volumes[volumeID]; !ok {
 		return Snapshot{}, ErrVolumeNotFound
 	}
-	list := append(s.snaps[volumeID], snap)
-	s.snaps[volumeID] = list
+	if _, exists := s.snapshotLocked(snap.SnapshotID); exists {
+		return Snapshot{}, fmt.Errorf("%w: snapshot %s", ErrIDConflict, snap.SnapshotID)
+	}
+	prev := s.snaps[volumeID]
+	s.snaps[volumeID] = append(prev[:len(prev):len(prev)], snap)
 	if err := s.flushLocked(); err != nil {
+		s.snaps[volumeID] = prev
 		return Snapshot{}, err
 	}
 	return snap, nil
 }
 
+// AddSnapshots stores a batch of snapshot records in a single write. Either
+// every record is persisted or none are.
+func (s *FileStore) AddSnapshots(snaps []Snapshot) ([]Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkSnapshotIDsLocked(snaps); err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		if _, ok := s.volumes[snap.VolumeID]; !ok {
+			return nil, ErrVolumeNotFound
+		}
+	}
+	prev := make(map[string][]Snapshot, len(snaps))
+	for _, snap := range snaps {
+		if _, seen := prev[snap.VolumeID]; !seen {
+			prev[snap.VolumeID] = s.snaps[snap.VolumeID]
+		}
+		s.snaps[snap.VolumeID] = append(s.snaps[snap.VolumeID], snap)
+	}
+	if err := s.flushLocked(); err != nil {
+		for vid, list := range prev {
+			s.snaps[vid] = list
+		}
+		return nil, err
+	}
+	return append([]Snapshot{}, snaps...), nil
+}
+
 // ListSnapshots returns snapshot records for a volume.
 func (s *FileStore) ListSnapshots(volumeID string) []Snapshot {
 	s.mu.RLock()
@@ -184,6 +349,40 @@ func (s *FileStore) LatestSnapshot(volumeID string) (Snapshot, bool) {
 	return snaps[len(snaps)-1], true
 }
 
+// GetSnapshot returns a snapshot record by ID.
+func (s *FileStore) GetSnapshot(snapshotID string) (Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if snap, ok := s.snapshotLocked(snapshotID); ok {
+		return snap, nil
+	}
+	return Snapshot{}, ErrSnapshotNotFound
+}
+
+func (s *FileStore) snapshotLocked(snapshotID string) (Snapshot, bool) {
+	for _, snaps := range s.snaps {
+		for _, snap := range snaps {
+			if snap.SnapshotID == snapshotID {
+				return snap, true
+			}
+		}
+	}
+	return Snapshot{}, false
+}
+
+// checkSnapshotIDsLocked rejects a batch whose snapshot IDs repeat each
+// other or an existing snapshot.
+func (s *FileStore) checkSnapshotIDsLocked(snaps []Snapshot) error {
+	batch := make(map[string]bool, len(snaps))
+	for _, snap := range snaps {
+		if _, exists := s.snapshotLocked(snap.SnapshotID); exists || batch[snap.SnapshotID] {
+			return fmt.Errorf("%w: snapshot %s", ErrIDConflict, snap.SnapshotID)
+		}
+		batch[snap.SnapshotID] = true
+	}
+	return nil
+}
+
 // VolumeIDForSnapshot finds the owning volume for a snapshot id.
 func (s *FileStore) VolumeIDForSnapshot(snapshotID string) (string, bool) {
 	s.mu.RLock()
@@ -198,17 +397,45 @@ func (s *FileStore) VolumeIDForSnapshot(snapshotID string) (string, bool) {
 	return "", false
 }
 
-// PutCheckpoint stores a checkpoint manifest.
-func (s *FileStore) PutCheckpoint(cp Checkpoint) (Checkpoint, error) {
+// PutCheckpoint stores a new checkpoint manifest. It refuses to overwrite
+// an existing manifest with the same ID. When capsule is non-nil it is
+// written first, so a manifest is never recorded without its capsule.
+func (s *FileStore) PutCheckpoint(cp Checkpoint, capsuleType string, capsule []byte) (Checkpoint, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if _, exists := s.cp[cp.ManifestID]; exists {
+		return Checkpoint{}, fmt.Errorf("%w: checkpoint %s", ErrIDConflict, cp.ManifestID)
+	}
+	cp.Capsule = nil
+	if capsule != nil {
+		info, err := s.writeCapsuleLocked(cp.ManifestID, capsuleType, capsule)
+		if err != nil {
+			return Checkpoint{}, err
+		}
+		cp.Capsule = &info
+	}
 	s.cp[cp.ManifestID] = cp
 	if err := s.flushLocked(); err != nil {
+		delete(s.cp, cp.ManifestID)
+		if capsule != nil {
+			_ = os.Remove(s.capsulePath(cp.ManifestID))
+		}
 		return Checkpoint{}, err
 	}
 	return cp, nil
 }
 
+// GetCheckpoint returns a checkpoint manifest by ID.
+func (s *FileStore) GetCheckpoint(id string) (Checkpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cp, ok := s.cp[id]
+	if !ok {
+		return Checkpoint{}, ErrCheckpointNotFound
+	}
+	return cp, nil
+}
+
 // ListCheckpoints returns all checkpoint manifests.
 func (s *FileStore) ListCheckpoints() []Checkpoint {
 	s.mu.RLock()
@@ -217,18 +444,93 @@ func (s *FileStore) ListCheckpoints() []Checkpoint {
 	for _, v := range s.cp {
 		out = append(out, v)
 	}
+	sort.Slice(out, func(i, j int) bool { return ids.Less(out[i].ManifestID, out[j].ManifestID) })
 	return out
 }
 
-// DeleteVolume removes a volume.
+// DeleteVolume removes a volume. The volume must already be in the deleting
+// state so the removal completes the deleting -> deleted transition.
 func (s *FileStore) DeleteVolume(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.volumes[id]; !ok {
+	v, ok := s.volumes[id]
+	if !ok {
 		return ErrVolumeNotFound
 	}
+	if err := lifecycle.Check(v.AttachState, lifecycle.Deleted); err != nil {
+		return err
+	}
 	delete(s.volumes, id)
-	return s.flushLocked()
+	s.labelIndex.update(id, v.Labels, nil)
+	s.names.update(id, v, Volume{})
+	if err := s.flushLocked(); err != nil {
+		s.volumes[id] = v
+		s.labelIndex.update(id, nil, v.Labels)
+		s.names.update(id, Volume{}, v)
+		return err
+	}
+	return nil
+}
+
+// maxTransitions bounds the lifecycle history kept on each volume.
+const maxTransitions = 32
+
+// TransitionVolume moves a volume to a new lifecycle state. The transition is
+// validated against the lifecycle table, mutate (if non-nil) may adjust the
+// record and fail the change, and the transition is appended to the volume's
+// history. Illegal transitions return a *lifecycle.TransitionError.
+func (s *FileStore) TransitionVolume(id string, to lifecycle.State, reason, principal string, mutate func(*Volume) error) (Volume, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.volumes[id]
+	if !ok {
+		return Volume{}, ErrVolumeNotFound
+	}
+	from := v.AttachState
+	if err := lifecycle.Check(from, to); err != nil {
+		return Volume{}, err
+	}
+	prev := v
+	v.Transitions = append([]lifecycle.Transition{}, v.Transitions...)
+	if mutate != nil {
+		if err := mutate(&v); err != nil {
+			return Volume{}, err
+		}
+	}
+	now := time.Now().UTC()
+	v.recordTransition(to, reason, principal, now)
+	v.UpdatedAt = now
+	s.volumes[id] = v
+	if err := s.flushLocked(); err != nil {
+		s.volumes[id] = prev
+		return Volume{}, err
+	}
+	return v, nil
+}
+
+// UpdateVolume applies mutate to a volume without changing its lifecycle
+// state. mutate may inspect the current record and fail the update.
+func (s *FileStore) UpdateVolume(id string, mutate func(*Volume) error) (Volume, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.volumes[id]
+	if !ok {
+		return Volume{}, ErrVolumeNotFound
+	}
+	prev := v
+	state := v.AttachState
+	if err := mutate(&v); err != nil {
+		return Volume{}, err
+	}
+	v.AttachState = state
+	v.MountHandle.State = state
+	v.UpdatedAt = time.Now().UTC()
+	s.volumes[id] = v
+	if err := s.flushLocked(); err != nil {
+		s.volumes[id] = prev
+		return Volume{}, err
+	}
+	return v, nil
 }
 
 func (s *FileStore) load() error {
@@ -256,9 +558,28 @@ func (s *FileStore) load() error {
 	if fs.Checkpoints == nil {
 		fs.Checkpoints = map[string]Checkpoint{}
 	}
+	if fs.Operations == nil {
+		fs.Operations = map[string]Operation{}
+	}
+	if fs.Profiles == nil {
+		fs.Profiles = map[string]policy.Profile{}
+	}
 	s.volumes = fs.Volumes
 	s.snaps = fs.Snapshots
 	s.cp = fs.Checkpoints
+	s.ops = fs.Operations
+	s.audit = fs.Audit
+	if fs.Idempotency != nil {
+		s.idempotency = fs.Idempotency
+	}
+	if fs.Revoked != nil {
+		s.revoked = fs.Revoked
+	}
+	s.profiles = fs.Profiles
+	s.migrateSessionsLocked()
+	s.failInterruptedLocked()
+	s.reindexLocked()
+	s.reindexNamesLocked()
 	return nil
 }
 
@@ -274,6 +595,11 @@ func (s *FileStore) flushLocked() error {
 		Volumes:     s.volumes,
 		Snapshots:   s.snaps,
 		Checkpoints: s.cp,
+		Operations:  s.ops,
+		Audit:       s.audit,
+		Idempotency: s.idempotency,
+		Profiles:    s.profiles,
+		Revoked:     s.revoked,
 	}
 	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
 	if err != nil {
@@ -293,3 +619,73 @@ func (s *FileStore) flushLocked() error {
 	}
 	return nil
 }
+
+// ImportCheckpoint stores the volumes, snapshots and manifest of an imported
+// checkpoint in a single write. When capsule is non-nil it is written first
+// and recorded on the manifest.
+func (s *FileStore) ImportCheckpoint(vols []Volume, snaps []Snapshot, cp Checkpoint, capsuleType string, capsule []byte) (Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	grow := map[string]int64{}
+	batchNames := map[nameKey]bool{}
+	for _, v := range vols {
+		if _, exists := s.volumes[v.VolumeID]; exists {
+			return Checkpoint{}, fmt.Errorf("%w: volume %s", ErrIDConflict, v.VolumeID)
+		}
+		if v.Name != "" {
+			key := nameKey{v.OwnerPrincipal, v.Name}
+			if s.claimedLocked(v) || batchNames[key] {
+				return Checkpoint{}, fmt.Errorf("%w: %s", ErrNameTaken, v.Name)
+			}
+			batchNames[key] = true
+		}
+		grow[v.poolClass()] += v.Provisioned()
+	}
+	for class, bytes := range grow {
+		if err := s.reserveLocked(class, bytes); err != nil {
+			return Checkpoint{}, err
+		}
+	}
+	if _, exists := s.cp[cp.ManifestID]; exists {
+		return Checkpoint{}, fmt.Errorf("%w: checkpoint %s", ErrIDConflict, cp.ManifestID)
+	}
+	if err := s.checkSnapshotIDsLocked(snaps); err != nil {
+		return Checkpoint{}, err
+	}
+
+	cp.Capsule = nil
+	if capsule != nil {
+		info, err := s.writeCapsuleLocked(cp.ManifestID, capsuleType, capsule)
+		if err != nil {
+			return Checkpoint{}, err
+		}
+		cp.Capsule = &info
+	}
+
+	now := time.Now().UTC()
+	for _, v := range vols {
+		v.CreatedAt = now
+		v.UpdatedAt = now
+		s.volumes[v.VolumeID] = v
+		s.labelIndex.update(v.VolumeID, nil, v.Labels)
+		s.names.update(v.VolumeID, Volume{}, v)
+	}
+	for _, snap := range snaps {
+		s.snaps[snap.VolumeID] = append(s.snaps[snap.VolumeID], snap)
+	}
+	s.cp[cp.ManifestID] = cp
+	if err := s.flushLocked(); err != nil {
+		for _, v := range vols {
+			delete(s.volumes, v.VolumeID)
+			delete(s.snaps, v.VolumeID)
+			s.labelIndex.update(v.VolumeID, v.Labels, nil)
+			s.names.update(v.VolumeID, v, Volume{})
+		}
+		delete(s.cp, cp.ManifestID)
+		if capsule != nil {
+			_ = os.Remove(s.capsulePath(cp.ManifestID))
+		}
+		return Checkpoint{}, err
+	}
+	return cp, nil
+}
@@ -0,0 +1,76 @@
+package store
+
+import "time"
+
+// Transfer is an ownership change the current owner has offered and the
+// target principal has yet to accept.
+type Transfer struct {
+	ToPrincipal string    `json:"to_principal"`
+	RequestedBy string    `json:"requested_by"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// TransferVolume hands a volume to a new owner and clears any pending
+// transfer. check may inspect the current record and fail the transfer.
+// Checkpoints the previous owner holds that only cover this volume move with
+// it; their IDs are returned. Snapshots follow the volume implicitly. The ACL
+// is kept, minus any entry for the new owner.
+func (s *FileStore) TransferVolume(id, to string, check func(Volume) error) (Volume, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.volumes[id]
+	if !ok {
+		return Volume{}, nil, ErrVolumeNotFound
+	}
+	if check != nil {
+		if err := check(v); err != nil {
+			return Volume{}, nil, err
+		}
+	}
+	prev := v
+	v.OwnerPrincipal = to
+	v.PendingTransfer = nil
+	v.ACL = withoutPrincipal(v.ACL, to)
+	if s.claimedLocked(v) {
+		return Volume{}, nil, ErrNameTaken
+	}
+	v.UpdatedAt = time.Now().UTC()
+
+	var moved []string
+	for cid, cp := range s.cp {
+		if cp.OwnerPrincipal == prev.OwnerPrincipal && s.coversOnlyLocked(cp, id) {
+			cp.OwnerPrincipal = to
+			s.cp[cid] = cp
+			moved = append(moved, cid)
+		}
+	}
+	s.volumes[id] = v
+	s.names.update(id, prev, v)
+	if err := s.flushLocked(); err != nil {
+		s.volumes[id] = prev
+		s.names.update(id, v, prev)
+		for _, cid := range moved {
+			cp := s.cp[cid]
+			cp.OwnerPrincipal = prev.OwnerPrincipal
+			s.cp[cid] = cp
+		}
+		return Volume{}, nil, err
+	}
+	sortIDs(moved)
+	return v, moved, nil
+}
+
+// coversOnlyLocked reports whether every snapshot in cp belongs to the
+// volume.
+func (s *FileStore) coversOnlyLocked(cp Checkpoint, volumeID string) bool {
+	if len(cp.SnapshotIDs) == 0 {
+		return false
+	}
+	for _, sid := range cp.SnapshotIDs {
+		snap, ok := s.snapshotLocked(sid)
+		if !ok || snap.VolumeID != volumeID {
+			return false
+		}
+	}
+	return true
+}
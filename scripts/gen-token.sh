@@ -4,13 +4,25 @@ set -euo pipefail
 TOKEN=${1:-$(openssl rand -hex 16)}
 PRINCIPAL=${2:-service:demo}
 OUTPUT=${3:-tokens.json}
+ROLE=${4:-}
 
-cat <<JSON > "$OUTPUT"
+if [[ -n "$ROLE" ]]; then
+  cat <<JSON > "$OUTPUT"
+{
+  "$TOKEN": { "principal": "$PRINCIPAL", "role": "$ROLE" }
+}
+JSON
+else
+  cat <<JSON > "$OUTPUT"
 {
   "$TOKEN": "$PRINCIPAL"
 }
 JSON
+fi
 
 echo "Wrote token file to $OUTPUT"
 echo "Token: $TOKEN"
 echo "Principal: $PRINCIPAL"
+if [[ -n "$ROLE" ]]; then
+  echo "Role: $ROLE"
+fi